@@ -1,13 +1,20 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"path/filepath"
+	"time"
 
+	"github.com/karprabha/chirpy/internal/auth"
 	"github.com/karprabha/chirpy/internal/config"
 	"github.com/karprabha/chirpy/internal/handler"
 	"github.com/karprabha/chirpy/internal/middleware"
+	"github.com/karprabha/chirpy/internal/outbound"
+	"github.com/karprabha/chirpy/internal/policy"
+	"github.com/karprabha/chirpy/internal/subscription"
+	"github.com/karprabha/chirpy/internal/webhooksig"
 )
 
 func getRootPath() string {
@@ -23,35 +30,101 @@ func main() {
 	appConfig := config.New()
 	defer appConfig.DB.Close()
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go subscription.RunExpiry(ctx, appConfig.DB, appConfig.Queries, time.Minute)
+	go outbound.NewWorker(appConfig.Queries, appConfig.AllowPrivateWebhooks).Run(ctx, 5*time.Second)
+
 	mux := http.NewServeMux()
 
 	fileHandler := http.FileServer(http.Dir(getRootPath()))
 	mux.Handle("/app/", middleware.WithMetrics(appConfig, http.StripPrefix("/app/", fileHandler)))
 
 	// Admin routes
-	mux.Handle("GET /admin/metrics", handler.AdminMetrics(appConfig))
-	mux.Handle("POST /admin/reset", handler.AdminReset(appConfig))
+	admin := func(p policy.Permission, h http.Handler) http.Handler {
+		return middleware.WithAuth(appConfig, auth.ScopeAdmin, middleware.WithPermission(p, h))
+	}
+	mux.Handle("GET /admin/metrics", admin(policy.ViewMetrics, handler.AdminMetrics(appConfig)))
+	mux.Handle("POST /admin/reset", admin(policy.ResetData, handler.AdminReset(appConfig)))
+	mux.Handle("POST /admin/bootstrap", middleware.WithAuth(appConfig, auth.ScopeAccount, handler.AdminBootstrap(appConfig)))
+	mux.Handle("PUT /admin/users/{id}/role", admin(policy.ManageRoles, handler.AdminUpdateUserRole(appConfig)))
+	mux.Handle("DELETE /admin/users/{id}/lockout", admin(policy.ManageLockouts, handler.AdminUnlockUser(appConfig)))
+	mux.Handle("GET /admin/lockouts", admin(policy.ViewLockouts, handler.AdminListLockouts(appConfig)))
+	mux.Handle("GET /admin/users/{id}/subscription-history", admin(policy.ViewSubscriptions, handler.AdminGetSubscriptionHistory(appConfig)))
+	mux.Handle("GET /admin/webhooks/events", admin(policy.ViewWebhookEvents, handler.AdminListWebhookEvents(appConfig)))
+	mux.Handle("GET /admin/webhooks/events/{id}", admin(policy.ViewWebhookEvents, handler.AdminGetWebhookEvent(appConfig)))
+	mux.Handle("POST /admin/webhooks/events/{id}/replay", admin(policy.ReplayWebhookEvents, handler.AdminReplayWebhookEvent(appConfig)))
 
 	// Health route
 	mux.Handle("GET /api/healthz", http.HandlerFunc(handler.Healthz))
 
+	// Public keys for verifying access tokens
+	mux.Handle("GET /.well-known/jwks.json", handler.JWKS(appConfig))
+
 	// Auth routes
 	mux.Handle("POST /api/login", handler.Login(appConfig))
+	mux.Handle("POST /api/login/mfa", handler.LoginMFA(appConfig))
+	mux.Handle("POST /api/login/passkey/options", handler.PasskeyLoginOptions(appConfig))
+	mux.Handle("POST /api/login/passkey", handler.LoginPasskey(appConfig))
 	mux.Handle("POST /api/revoke", handler.Revoke(appConfig))
 	mux.Handle("POST /api/refresh", handler.Refresh(appConfig))
+	mux.Handle("POST /api/password/forgot", handler.ForgotPassword(appConfig))
+	mux.Handle("POST /api/password/reset", handler.ResetPassword(appConfig))
+
+	// Session routes
+	mux.Handle("GET /api/sessions", middleware.WithAuth(appConfig, auth.ScopeAccount, handler.GetSessions(appConfig)))
+	mux.Handle("DELETE /api/sessions", middleware.WithAuth(appConfig, auth.ScopeAccount, handler.DeleteOtherSessions(appConfig)))
+	mux.Handle("DELETE /api/sessions/{id}", middleware.WithAuth(appConfig, auth.ScopeAccount, handler.DeleteSession(appConfig)))
 
 	// User routes
-	mux.Handle("PUT /api/users", handler.UpdateUser(appConfig))
+	mux.Handle("PUT /api/users", http.HandlerFunc(handler.UpdateUser))
 	mux.Handle("POST /api/users", handler.CreateUser(appConfig))
+	mux.Handle("POST /api/users/verify", handler.VerifyEmail(appConfig))
+	mux.Handle("POST /api/users/verify/resend", middleware.WithAuth(appConfig, auth.ScopeAccount, handler.ResendVerificationEmail(appConfig)))
+	mux.Handle("GET /api/users/me", middleware.WithAuth(appConfig, auth.ScopeAccount, handler.GetMe(appConfig)))
+	mux.Handle("PATCH /api/users/me", middleware.WithAuth(appConfig, auth.ScopeAccount, handler.UpdateMe(appConfig)))
+	mux.Handle("POST /api/users/me/password", middleware.WithAuth(appConfig, auth.ScopeAccount, handler.ChangePassword(appConfig)))
+	mux.Handle("POST /api/users/me/email", middleware.WithAuth(appConfig, auth.ScopeAccount, handler.ChangeEmail(appConfig)))
+	mux.Handle("POST /api/users/email/confirm", handler.ConfirmEmailChange(appConfig))
+	mux.Handle("PUT /api/users/preferences", middleware.WithAuth(appConfig, auth.ScopeAccount, handler.UpdatePreferences(appConfig)))
+	mux.Handle("GET /api/users/me/entitlements", middleware.WithAuth(appConfig, auth.ScopeAccount, handler.GetEntitlements(appConfig)))
+
+	// Two-factor authentication
+	mux.Handle("GET /api/users/me/totp", middleware.WithAuth(appConfig, auth.ScopeAccount, handler.GetTOTPStatus(appConfig)))
+	mux.Handle("POST /api/users/me/totp", middleware.WithAuth(appConfig, auth.ScopeAccount, handler.EnrollTOTP(appConfig)))
+	mux.Handle("POST /api/users/me/totp/confirm", middleware.WithAuth(appConfig, auth.ScopeAccount, handler.ConfirmTOTP(appConfig)))
+	mux.Handle("DELETE /api/users/me/totp", middleware.WithAuth(appConfig, auth.ScopeAccount, handler.DisableTOTP(appConfig)))
+
+	// Passkeys
+	mux.Handle("GET /api/users/me/passkeys", middleware.WithAuth(appConfig, auth.ScopeAccount, handler.GetPasskeys(appConfig)))
+	mux.Handle("POST /api/users/me/passkeys/options", middleware.WithAuth(appConfig, auth.ScopeAccount, handler.PasskeyRegistrationOptions(appConfig)))
+	mux.Handle("POST /api/users/me/passkeys", middleware.WithAuth(appConfig, auth.ScopeAccount, handler.RegisterPasskey(appConfig)))
+	mux.Handle("DELETE /api/users/me/passkeys/{id}", middleware.WithAuth(appConfig, auth.ScopeAccount, handler.DeletePasskey(appConfig)))
 
 	// Chirp routes
-	mux.Handle("POST /api/chirps", handler.CreateChirp(appConfig))
-	mux.Handle("GET /api/chirps", handler.GetChirps(appConfig))
-	mux.Handle("GET /api/chirps/{id}", handler.GetChirp(appConfig))
-	mux.Handle("DELETE /api/chirps/{id}", handler.DeleteChirp(appConfig))
+	mux.Handle("POST /api/chirps", middleware.WithAuth(appConfig, auth.ScopeChirpsWrite, handler.CreateChirp(appConfig)))
+	mux.Handle("GET /api/chirps", middleware.WithOptionalAuth(appConfig, handler.GetChirps(appConfig)))
+	mux.Handle("GET /api/chirps/{id}", middleware.WithOptionalAuth(appConfig, handler.GetChirp(appConfig)))
+	mux.Handle("DELETE /api/chirps/{id}", middleware.WithAuth(appConfig, auth.ScopeChirpsWrite, handler.DeleteChirp(appConfig)))
+	mux.Handle("POST /api/chirps/{id}/poll/votes", middleware.WithAuth(appConfig, auth.ScopeChirpsWrite, handler.VotePoll(appConfig)))
+
+	// Short link routes
+	mux.Handle("GET /l/{code}", handler.FollowLink(appConfig))
 
 	// Webhooks routes
-	mux.Handle("POST /api/polka/webhooks", handler.PolkaWebhook(appConfig))
+	mux.Handle("POST /api/webhooks/endpoints", middleware.WithAuth(appConfig, auth.ScopeWebhooks, handler.CreateWebhookEndpoint(appConfig)))
+	mux.Handle("GET /api/webhooks/endpoints", middleware.WithAuth(appConfig, auth.ScopeWebhooks, handler.GetWebhookEndpoints(appConfig)))
+	mux.Handle("DELETE /api/webhooks/endpoints/{id}", middleware.WithAuth(appConfig, auth.ScopeWebhooks, handler.DeleteWebhookEndpoint(appConfig)))
+	mux.Handle("POST /api/webhooks/endpoints/{id}/enable", middleware.WithAuth(appConfig, auth.ScopeWebhooks, handler.EnableWebhookEndpoint(appConfig)))
+	mux.Handle("GET /api/webhooks/endpoints/{id}/deliveries", middleware.WithAuth(appConfig, auth.ScopeWebhooks, handler.GetWebhookDeliveries(appConfig)))
+	var polkaWebhook http.Handler = handler.PolkaWebhook(appConfig)
+	if len(appConfig.PolkaSigningSecrets) > 0 {
+		polkaWebhook = middleware.WithWebhookSignature(webhooksig.NewVerifier(appConfig.PolkaSigningSecrets), "Polka-Signature", polkaWebhook)
+	} else {
+		polkaWebhook = middleware.WithAPIKey(appConfig.PolkaKey, polkaWebhook)
+	}
+	mux.Handle("POST /api/polka/webhooks", polkaWebhook)
 
 	log.Println("Server running on :8080")
 	log.Fatal(http.ListenAndServe(":8080", mux))
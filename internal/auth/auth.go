@@ -1,7 +1,9 @@
 package auth
 
 import (
+	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"net/http"
@@ -29,48 +31,100 @@ func CheckPasswordHash(password, hash string) error {
 	return nil
 }
 
+// MakeJWT issues an access token signed with an HS256 shared secret.
 func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	now := time.Now().UTC()
+	return NewHMACKeySet(tokenSecret).MakeAccessToken(Claims{UserID: userID}, expiresIn)
+}
+
+// MakeAccessToken issues an access token for c.UserID with c's session, role
+// and scopes, signed with the key set's signing key. The token ID and times
+// are set here.
+func (ks *KeySet) MakeAccessToken(c Claims, expiresIn time.Duration) (string, error) {
+	return ks.sign(newTokenClaims(c, ks.Issuer, ks.Audience, time.Now().UTC(), expiresIn))
+}
 
-	claims := jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  jwt.NewNumericDate(now),
-		ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
-		Subject:   userID.String(),
+// ValidateOption adds a check to KeySet.Validate.
+type ValidateOption func(*validateOptions)
+
+type validateOptions struct {
+	ctx         context.Context
+	revocations *RevocationCache
+}
+
+// WithRevocationCheck rejects tokens that were revoked after being issued,
+// as recorded in c. A nil c disables the check.
+func WithRevocationCheck(ctx context.Context, c *RevocationCache) ValidateOption {
+	return func(o *validateOptions) {
+		o.ctx = ctx
+		o.revocations = c
 	}
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(tokenSecret))
+// ValidateJWT validates an access token signed with an HS256 shared secret.
+func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+	claims, err := NewHMACKeySet(tokenSecret).Validate(tokenString)
 	if err != nil {
-		return "", err
+		return uuid.Nil, err
 	}
-
-	return tokenString, nil
+	return claims.UserID, nil
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		return []byte(tokenSecret), nil
-	})
+// Validate checks an access token's signature, expiry, issuer and audience
+// and returns its claims.
+func (ks *KeySet) Validate(tokenString string, opts ...ValidateOption) (*Claims, error) {
+	var o validateOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
 
+	token, err := jwt.ParseWithClaims(tokenString, &tokenClaims{}, ks.keyFunc,
+		jwt.WithIssuer(ks.Issuer),
+		jwt.WithAudience(ks.Audience),
+		jwt.WithExpirationRequired(),
+	)
 	if err != nil {
-		return uuid.Nil, err
+		return nil, err
 	}
 
-	claims, ok := token.Claims.(*jwt.RegisteredClaims)
+	tc, ok := token.Claims.(*tokenClaims)
 	if !ok || !token.Valid {
-		return uuid.Nil, errors.New("invalid token or claims")
+		return nil, errors.New("invalid token or claims")
 	}
 
-	userID, err := uuid.Parse(claims.Subject)
+	userID, err := uuid.Parse(tc.Subject)
 	if err != nil {
-		return uuid.Nil, errors.New("invalid user ID in token")
+		return nil, errors.New("invalid user ID in token")
 	}
 
-	return userID, nil
+	claims := &Claims{
+		UserID:    userID,
+		TokenID:   tc.ID,
+		Role:      tc.Role,
+		Scopes:    strings.Fields(tc.Scope),
+		ExpiresAt: tc.ExpiresAt.Time,
+	}
+
+	if tc.SessionID != "" {
+		claims.SessionID, err = uuid.Parse(tc.SessionID)
+		if err != nil {
+			return nil, errors.New("invalid session ID in token")
+		}
+	}
+
+	if tc.IssuedAt != nil {
+		claims.IssuedAt = tc.IssuedAt.Time
+	}
+
+	if o.revocations != nil {
+		if tc.IssuedAt == nil {
+			return nil, ErrTokenRevoked
+		}
+		if err := o.revocations.Check(o.ctx, userID, claims.SessionID, claims.IssuedAt); err != nil {
+			return nil, err
+		}
+	}
+
+	return claims, nil
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -100,6 +154,25 @@ func MakeRefreshToken() (string, error) {
 	return tokenString, nil
 }
 
+// HashRefreshToken returns the hex SHA-256 of a refresh token. Only the hash
+// is stored, so refresh tokens are looked up by it.
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// MakePasswordResetToken returns a random single-use password reset token.
+// Like refresh tokens, only its HashRefreshToken hash is stored.
+func MakePasswordResetToken() (string, error) {
+	return MakeRefreshToken()
+}
+
+// MakeEmailChangeToken returns a random single-use token confirming a new
+// email. Like refresh tokens, only its HashRefreshToken hash is stored.
+func MakeEmailChangeToken() (string, error) {
+	return MakeRefreshToken()
+}
+
 func GetAPIKey(headers http.Header) (string, error) {
 	apiKeyHeader := headers.Get("Authorization")
 	if apiKeyHeader == "" {
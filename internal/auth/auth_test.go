@@ -2,6 +2,7 @@ package auth
 
 import (
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
@@ -229,3 +230,88 @@ func TestGetBearerToken(t *testing.T) {
 		})
 	}
 }
+
+func TestHashRefreshToken(t *testing.T) {
+	token, err := MakeRefreshToken()
+	if err != nil {
+		t.Fatalf("MakeRefreshToken returned error: %v", err)
+	}
+
+	hash := HashRefreshToken(token)
+	if hash == token {
+		t.Errorf("hash should not equal the token")
+	}
+	if hash != HashRefreshToken(token) {
+		t.Errorf("hash should be deterministic")
+	}
+
+	// Must match encode(sha256(...), 'hex') used by the migration.
+	if got, want := HashRefreshToken("abc"), "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"; got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+func TestValidateSession(t *testing.T) {
+	ks := NewHMACKeySet("mysecretkey")
+	userID := uuid.New()
+	sessionID := uuid.New()
+
+	cases := []struct {
+		name          string
+		sessionID     uuid.UUID
+		expectSession uuid.UUID
+	}{
+		{name: "with session", sessionID: sessionID, expectSession: sessionID},
+		{name: "without session", sessionID: uuid.Nil, expectSession: uuid.Nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			token, err := ks.MakeAccessToken(Claims{UserID: userID, SessionID: tc.sessionID}, time.Hour)
+			if err != nil {
+				t.Fatalf("failed to create token: %v", err)
+			}
+
+			claims, err := ks.Validate(token)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if claims.UserID != userID {
+				t.Errorf("expected userID %v, got %v", userID, claims.UserID)
+			}
+			if claims.SessionID != tc.expectSession {
+				t.Errorf("expected sessionID %v, got %v", tc.expectSession, claims.SessionID)
+			}
+		})
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := MakeRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("MakeRecoveryCodes returned error: %v", err)
+	}
+	if len(codes) != 10 {
+		t.Fatalf("expected 10 codes, got %d", len(codes))
+	}
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 19 || strings.Count(code, "-") != 3 {
+			t.Errorf("unexpected code format %q", code)
+		}
+		if seen[code] {
+			t.Errorf("duplicate code %q", code)
+		}
+		seen[code] = true
+	}
+
+	code := codes[0]
+	loose := strings.ToLower(strings.ReplaceAll(code, "-", " "))
+	if HashRecoveryCode(loose) != HashRecoveryCode(code) {
+		t.Errorf("expected %q and %q to hash the same", loose, code)
+	}
+	if HashRecoveryCode(codes[1]) == HashRecoveryCode(code) {
+		t.Errorf("expected different codes to hash differently")
+	}
+}
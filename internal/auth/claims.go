@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Default issuer and audience of access tokens.
+const (
+	DefaultIssuer   = "chirpy"
+	DefaultAudience = "chirpy-api"
+)
+
+// Roles a user can have. What each role may do is defined in the policy
+// package.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Scopes an access token can be granted.
+const (
+	// ScopeChirpsWrite allows posting and deleting chirps and voting in polls.
+	ScopeChirpsWrite = "chirps:write"
+	// ScopeAccount allows reading and changing the user's account, sessions
+	// and preferences.
+	ScopeAccount = "account"
+	// ScopeWebhooks allows managing outbound webhook endpoints.
+	ScopeWebhooks = "webhooks"
+	// ScopeAdmin allows the admin API.
+	ScopeAdmin = "admin"
+)
+
+// DefaultScopes are granted to tokens issued by logging in.
+var DefaultScopes = []string{ScopeChirpsWrite, ScopeAccount, ScopeWebhooks}
+
+// Claims are the contents of a validated access token.
+type Claims struct {
+	UserID uuid.UUID
+	// SessionID is uuid.Nil for tokens issued without a session.
+	SessionID uuid.UUID
+	TokenID   string
+	Role      string
+	Scopes    []string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// HasScope reports whether the token was granted scope.
+func (c *Claims) HasScope(scope string) bool {
+	return slices.Contains(c.Scopes, scope)
+}
+
+// tokenClaims is the JSON form of Claims. Scopes are space separated in a
+// single "scope" claim, as in RFC 8693.
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	SessionID string `json:"sid,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	Role      string `json:"role,omitempty"`
+}
+
+func newTokenClaims(c Claims, issuer, audience string, now time.Time, expiresIn time.Duration) tokenClaims {
+	claims := tokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Audience:  jwt.ClaimStrings{audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+			Subject:   c.UserID.String(),
+			ID:        uuid.NewString(),
+		},
+		Scope: strings.Join(c.Scopes, " "),
+		Role:  c.Role,
+	}
+	if c.SessionID != uuid.Nil {
+		claims.SessionID = c.SessionID.String()
+	}
+	return claims
+}
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestMakeAccessTokenClaims(t *testing.T) {
+	ks := NewHMACKeySet("mysecretkey")
+	want := Claims{
+		UserID:    uuid.New(),
+		SessionID: uuid.New(),
+		Role:      RoleUser,
+		Scopes:    []string{ScopeChirpsWrite, ScopeAccount},
+	}
+
+	token, err := ks.MakeAccessToken(want, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeAccessToken returned error: %v", err)
+	}
+
+	got, err := ks.Validate(token)
+	if err != nil {
+		t.Fatalf("Validate returned error: %v", err)
+	}
+
+	if got.UserID != want.UserID || got.SessionID != want.SessionID || got.Role != want.Role {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+	if !slices.Equal(got.Scopes, want.Scopes) {
+		t.Errorf("expected scopes %v, got %v", want.Scopes, got.Scopes)
+	}
+	if got.TokenID == "" {
+		t.Errorf("expected a token ID")
+	}
+	if !got.HasScope(ScopeChirpsWrite) || got.HasScope(ScopeAdmin) {
+		t.Errorf("unexpected HasScope result for scopes %v", got.Scopes)
+	}
+}
+
+func TestValidateIssuerAndAudience(t *testing.T) {
+	secret := "mysecretkey"
+	now := time.Now()
+
+	sign := func(claims jwt.RegisteredClaims) string {
+		t.Helper()
+		claims.Subject = uuid.NewString()
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+		return token
+	}
+
+	expires := jwt.NewNumericDate(now.Add(time.Hour))
+	audience := jwt.ClaimStrings{DefaultAudience}
+
+	cases := []struct {
+		name        string
+		token       string
+		expectError bool
+	}{
+		{name: "valid", token: sign(jwt.RegisteredClaims{Issuer: DefaultIssuer, Audience: audience, ExpiresAt: expires})},
+		{name: "one of several audiences", token: sign(jwt.RegisteredClaims{Issuer: DefaultIssuer, Audience: jwt.ClaimStrings{"other", DefaultAudience}, ExpiresAt: expires})},
+		{name: "wrong issuer", token: sign(jwt.RegisteredClaims{Issuer: "someone-else", Audience: audience, ExpiresAt: expires}), expectError: true},
+		{name: "missing issuer", token: sign(jwt.RegisteredClaims{Audience: audience, ExpiresAt: expires}), expectError: true},
+		{name: "wrong audience", token: sign(jwt.RegisteredClaims{Issuer: DefaultIssuer, Audience: jwt.ClaimStrings{"other"}, ExpiresAt: expires}), expectError: true},
+		{name: "missing audience", token: sign(jwt.RegisteredClaims{Issuer: DefaultIssuer, ExpiresAt: expires}), expectError: true},
+		{name: "missing expiry", token: sign(jwt.RegisteredClaims{Issuer: DefaultIssuer, Audience: audience}), expectError: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewHMACKeySet(secret).Validate(tc.token)
+			if tc.expectError && err == nil {
+				t.Errorf("expected error but got none")
+			}
+			if !tc.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Purposes of email tokens. The purpose is the token's audience, so a token
+// made for one purpose is rejected for any other, and none is accepted as an
+// access token.
+const (
+	PurposeVerifyEmail = "chirpy-verify-email"
+)
+
+// emailTokenClaims binds a token to the address it was mailed to, so it stops
+// working once the user's email changes.
+type emailTokenClaims struct {
+	jwt.RegisteredClaims
+	Email string `json:"email"`
+}
+
+// MakeEmailToken issues a token for purpose that proves the holder received
+// mail at email for userID. It is signed like an access token.
+func (ks *KeySet) MakeEmailToken(purpose string, userID uuid.UUID, email string, expiresIn time.Duration) (string, error) {
+	now := time.Now().UTC()
+	return ks.sign(emailTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    ks.Issuer,
+			Audience:  jwt.ClaimStrings{purpose},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+			Subject:   userID.String(),
+		},
+		Email: email,
+	})
+}
+
+// ValidateEmailToken checks a token made by MakeEmailToken for purpose and
+// returns the user and address it was issued for.
+func (ks *KeySet) ValidateEmailToken(purpose, tokenString string) (uuid.UUID, string, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &emailTokenClaims{}, ks.keyFunc,
+		jwt.WithIssuer(ks.Issuer),
+		jwt.WithAudience(purpose),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+
+	claims, ok := token.Claims.(*emailTokenClaims)
+	if !ok || !token.Valid || claims.Email == "" {
+		return uuid.Nil, "", errors.New("invalid token or claims")
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.Nil, "", errors.New("invalid user ID in token")
+	}
+
+	return userID, claims.Email, nil
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestEmailToken(t *testing.T) {
+	ks := NewHMACKeySet("mysecretkey")
+	userID := uuid.New()
+
+	token, err := ks.MakeEmailToken(PurposeVerifyEmail, userID, "user@example.com", time.Hour)
+	if err != nil {
+		t.Fatalf("MakeEmailToken returned error: %v", err)
+	}
+
+	gotID, gotEmail, err := ks.ValidateEmailToken(PurposeVerifyEmail, token)
+	if err != nil {
+		t.Fatalf("ValidateEmailToken returned error: %v", err)
+	}
+	if gotID != userID || gotEmail != "user@example.com" {
+		t.Errorf("expected %s %s, got %s %s", userID, "user@example.com", gotID, gotEmail)
+	}
+
+	if _, _, err := ks.ValidateEmailToken("chirpy-other-purpose", token); err == nil {
+		t.Errorf("expected a token for another purpose to be rejected")
+	}
+	if _, err := ks.Validate(token); err == nil {
+		t.Errorf("expected an email token to be rejected as an access token")
+	}
+	if _, _, err := NewHMACKeySet("othersecret").ValidateEmailToken(PurposeVerifyEmail, token); err == nil {
+		t.Errorf("expected a token signed with another key to be rejected")
+	}
+
+	expired, err := ks.MakeEmailToken(PurposeVerifyEmail, userID, "user@example.com", -time.Minute)
+	if err != nil {
+		t.Fatalf("MakeEmailToken returned error: %v", err)
+	}
+	if _, _, err := ks.ValidateEmailToken(PurposeVerifyEmail, expired); err == nil {
+		t.Errorf("expected an expired token to be rejected")
+	}
+
+	access, err := ks.MakeAccessToken(Claims{UserID: userID}, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeAccessToken returned error: %v", err)
+	}
+	if _, _, err := ks.ValidateEmailToken(PurposeVerifyEmail, access); err == nil {
+		t.Errorf("expected an access token to be rejected as an email token")
+	}
+}
@@ -0,0 +1,249 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minRSABits is the smallest RSA modulus accepted for signing or verifying.
+const minRSABits = 2048
+
+// Key is an asymmetric key used to sign or verify access tokens. Keys parsed
+// from a public key can only verify.
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+// ParseKey reads an RSA or Ed25519 key from PEM: a PKCS #8 or PKCS #1
+// private key, or a PKIX public key. RSA keys sign with RS256 and Ed25519
+// keys with EdDSA. If id is empty the key's RFC 7638 thumbprint is used.
+func ParseKey(pemData []byte, id string) (*Key, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	var parsed any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return NewKey(parsed, id)
+}
+
+// NewKey wraps an RSA or Ed25519 private or public key. If id is empty the
+// key's RFC 7638 thumbprint is used.
+func NewKey(k any, id string) (*Key, error) {
+	key := &Key{ID: id}
+
+	switch k := k.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.private, key.public = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.Method, key.public = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.Method, key.private, key.public = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.Method, key.public = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", k)
+	}
+
+	if pub, ok := key.public.(*rsa.PublicKey); ok && pub.N.BitLen() < minRSABits {
+		return nil, fmt.Errorf("RSA key must be at least %d bits", minRSABits)
+	}
+
+	if key.ID == "" {
+		key.ID = key.Thumbprint()
+	}
+	return key, nil
+}
+
+// CanSign reports whether the key includes its private half.
+func (k *Key) CanSign() bool {
+	return k.private != nil
+}
+
+// JWK is a public key in JSON Web Key format.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWK returns the public half of the key.
+func (k *Key) JWK() JWK {
+	jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Method.Alg()}
+	switch pub := k.public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = b64(pub.N.Bytes())
+		jwk.E = b64(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = b64(pub)
+	}
+	return jwk
+}
+
+// Thumbprint returns the RFC 7638 SHA-256 thumbprint of the key.
+func (k *Key) Thumbprint() string {
+	jwk := k.JWK()
+
+	// The required members in lexicographic order, without whitespace.
+	var members any
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+	return b64(sum[:])
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// KeySet holds the key access tokens are signed with and every key they are
+// verified with. Tokens signed with an asymmetric key name it in their "kid"
+// header, so a previous key can keep verifying the tokens it signed while a
+// new key is rolled out.
+//
+// An HS256 shared secret may be configured as well. It signs tokens when
+// there is no asymmetric signing key, and verifies tokens without a "kid".
+//
+// Issuer and Audience are set on issued tokens and required on validated
+// ones.
+type KeySet struct {
+	Issuer   string
+	Audience string
+
+	signing *Key
+	keys    map[string]*Key
+	hmac    []byte
+}
+
+// NewKeySet builds a key set that signs with signing and also verifies with
+// verify. signing may be nil to sign with hmacSecret. hmacSecret may be empty
+// to reject HS256 tokens.
+func NewKeySet(signing *Key, verify []*Key, hmacSecret string) (*KeySet, error) {
+	ks := &KeySet{Issuer: DefaultIssuer, Audience: DefaultAudience, keys: map[string]*Key{}}
+	if hmacSecret != "" {
+		ks.hmac = []byte(hmacSecret)
+	}
+
+	if signing != nil {
+		if !signing.CanSign() {
+			return nil, fmt.Errorf("signing key %s has no private key", signing.ID)
+		}
+		ks.signing = signing
+		verify = append([]*Key{signing}, verify...)
+	} else if ks.hmac == nil {
+		return nil, errors.New("a signing key or HMAC secret is required")
+	}
+
+	for _, k := range verify {
+		if _, ok := ks.keys[k.ID]; ok {
+			return nil, fmt.Errorf("duplicate key ID %s", k.ID)
+		}
+		ks.keys[k.ID] = k
+	}
+
+	return ks, nil
+}
+
+// NewHMACKeySet returns a key set that signs and verifies with an HS256
+// shared secret only.
+func NewHMACKeySet(secret string) *KeySet {
+	return &KeySet{Issuer: DefaultIssuer, Audience: DefaultAudience, keys: map[string]*Key{}, hmac: []byte(secret)}
+}
+
+// JWKS returns the public verification keys as a JSON Web Key Set. The HMAC
+// secret is never included.
+func (ks *KeySet) JWKS() map[string][]JWK {
+	keys := make([]JWK, 0, len(ks.keys))
+	if ks.signing != nil {
+		keys = append(keys, ks.signing.JWK())
+	}
+	for id, k := range ks.keys {
+		if ks.signing == nil || id != ks.signing.ID {
+			keys = append(keys, k.JWK())
+		}
+	}
+	return map[string][]JWK{"keys": keys}
+}
+
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	if ks.signing == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(ks.hmac)
+	}
+
+	token := jwt.NewWithClaims(ks.signing.Method, claims)
+	token.Header["kid"] = ks.signing.ID
+	return token.SignedString(ks.signing.private)
+}
+
+// keyFunc picks the verification key named by the token. The key's own
+// algorithm must match the token's, so a public key can never be used as an
+// HMAC secret.
+func (ks *KeySet) keyFunc(t *jwt.Token) (any, error) {
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" {
+		if t.Method != jwt.SigningMethodHS256 || ks.hmac == nil {
+			return nil, errors.New("unexpected signing method")
+		}
+		return ks.hmac, nil
+	}
+
+	k, ok := ks.keys[kid]
+	if !ok {
+		return nil, errors.New("unknown key ID")
+	}
+	if t.Method.Alg() != k.Method.Alg() {
+		return nil, errors.New("unexpected signing method")
+	}
+	return k.public, nil
+}
@@ -0,0 +1,258 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func newTestKey(t *testing.T, alg string) *Key {
+	t.Helper()
+
+	var priv any
+	var err error
+	switch alg {
+	case "RS256":
+		priv, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "EdDSA":
+		_, priv, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	key, err := NewKey(priv, "")
+	if err != nil {
+		t.Fatalf("NewKey returned error: %v", err)
+	}
+	return key
+}
+
+func publicOnly(t *testing.T, k *Key) *Key {
+	t.Helper()
+
+	pub, err := NewKey(k.public, k.ID)
+	if err != nil {
+		t.Fatalf("NewKey returned error: %v", err)
+	}
+	return pub
+}
+
+func TestKeySetSignAndValidate(t *testing.T) {
+	for _, alg := range []string{"RS256", "EdDSA"} {
+		t.Run(alg, func(t *testing.T) {
+			key := newTestKey(t, alg)
+			ks, err := NewKeySet(key, nil, "")
+			if err != nil {
+				t.Fatalf("NewKeySet returned error: %v", err)
+			}
+
+			userID := uuid.New()
+			token, err := ks.MakeAccessToken(Claims{UserID: userID}, time.Hour)
+			if err != nil {
+				t.Fatalf("MakeAccessToken returned error: %v", err)
+			}
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &jwt.RegisteredClaims{})
+			if err != nil {
+				t.Fatalf("failed to parse token: %v", err)
+			}
+			if parsed.Header["kid"] != key.ID || parsed.Header["alg"] != alg {
+				t.Errorf("expected kid %q and alg %s, got %v and %v", key.ID, alg, parsed.Header["kid"], parsed.Header["alg"])
+			}
+
+			claims, err := ks.Validate(token)
+			if err != nil {
+				t.Fatalf("Validate returned error: %v", err)
+			}
+			if claims.UserID != userID {
+				t.Errorf("expected userID %v, got %v", userID, claims.UserID)
+			}
+		})
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	oldKey := newTestKey(t, "RS256")
+	newKey := newTestKey(t, "EdDSA")
+	userID := uuid.New()
+
+	before, err := NewKeySet(oldKey, nil, "hmac-secret")
+	if err != nil {
+		t.Fatalf("NewKeySet returned error: %v", err)
+	}
+	oldToken, err := before.MakeAccessToken(Claims{UserID: userID}, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeAccessToken returned error: %v", err)
+	}
+	hmacToken, err := MakeJWT(userID, "hmac-secret", time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT returned error: %v", err)
+	}
+
+	during, err := NewKeySet(newKey, []*Key{publicOnly(t, oldKey)}, "hmac-secret")
+	if err != nil {
+		t.Fatalf("NewKeySet returned error: %v", err)
+	}
+	newToken, err := during.MakeAccessToken(Claims{UserID: userID}, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeAccessToken returned error: %v", err)
+	}
+
+	after, err := NewKeySet(newKey, nil, "")
+	if err != nil {
+		t.Fatalf("NewKeySet returned error: %v", err)
+	}
+
+	cases := []struct {
+		name        string
+		ks          *KeySet
+		token       string
+		expectError bool
+	}{
+		{name: "old token during rotation", ks: during, token: oldToken},
+		{name: "new token during rotation", ks: during, token: newToken},
+		{name: "hmac token during rotation", ks: during, token: hmacToken},
+		{name: "new token before rotation", ks: before, token: newToken, expectError: true},
+		{name: "old token after rotation", ks: after, token: oldToken, expectError: true},
+		{name: "hmac token after rotation", ks: after, token: hmacToken, expectError: true},
+		{name: "new token after rotation", ks: after, token: newToken},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.ks.Validate(tc.token)
+			if tc.expectError && err == nil {
+				t.Errorf("expected error but got none")
+			}
+			if !tc.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestKeySetRejectsAlgorithmConfusion(t *testing.T) {
+	key := newTestKey(t, "RS256")
+	ks, err := NewKeySet(key, nil, "")
+	if err != nil {
+		t.Fatalf("NewKeySet returned error: %v", err)
+	}
+
+	// An attacker signs an HS256 token using the published public key as
+	// the HMAC secret.
+	pub, err := x509.MarshalPKIXPublicKey(key.public)
+	if err != nil {
+		t.Fatalf("failed to marshal public key: %v", err)
+	}
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:    DefaultIssuer,
+		Audience:  jwt.ClaimStrings{DefaultAudience},
+		Subject:   uuid.NewString(),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	})
+	token.Header["kid"] = key.ID
+	forged, err := token.SignedString(pubPEM)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+
+	if _, err := ks.Validate(forged); err == nil {
+		t.Errorf("expected error but got none")
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	key := newTestKey(t, "EdDSA")
+
+	priv, err := x509.MarshalPKCS8PrivateKey(key.private)
+	if err != nil {
+		t.Fatalf("failed to marshal private key: %v", err)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(key.public)
+	if err != nil {
+		t.Fatalf("failed to marshal public key: %v", err)
+	}
+
+	cases := []struct {
+		name        string
+		pem         []byte
+		expectSign  bool
+		expectError bool
+	}{
+		{name: "private key", pem: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: priv}), expectSign: true},
+		{name: "public key", pem: pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})},
+		{name: "not PEM", pem: []byte("not a key"), expectError: true},
+		{name: "certificate", pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: pub}), expectError: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			parsed, err := ParseKey(tc.pem, "")
+			if tc.expectError {
+				if err == nil {
+					t.Errorf("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if parsed.ID != key.ID {
+				t.Errorf("expected key ID %q, got %q", key.ID, parsed.ID)
+			}
+			if parsed.CanSign() != tc.expectSign {
+				t.Errorf("expected CanSign %v, got %v", tc.expectSign, parsed.CanSign())
+			}
+		})
+	}
+}
+
+func TestThumbprint(t *testing.T) {
+	// The example from RFC 7638, section 3.1.
+	n, err := base64.RawURLEncoding.DecodeString("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+	if err != nil {
+		t.Fatalf("failed to decode modulus: %v", err)
+	}
+
+	key, err := NewKey(&rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537}, "")
+	if err != nil {
+		t.Fatalf("NewKey returned error: %v", err)
+	}
+
+	if want := "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"; key.ID != want {
+		t.Errorf("expected thumbprint %s, got %s", want, key.ID)
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	signing := newTestKey(t, "EdDSA")
+	previous := newTestKey(t, "RS256")
+
+	ks, err := NewKeySet(signing, []*Key{previous}, "hmac-secret")
+	if err != nil {
+		t.Fatalf("NewKeySet returned error: %v", err)
+	}
+
+	keys := ks.JWKS()["keys"]
+	if len(keys) != 2 {
+		t.Fatalf("expected 2 keys, got %d", len(keys))
+	}
+	if keys[0].Kid != signing.ID || keys[0].Kty != "OKP" || keys[0].X == "" {
+		t.Errorf("unexpected signing key %+v", keys[0])
+	}
+	if keys[1].Kid != previous.ID || keys[1].Kty != "RSA" || keys[1].E != "AQAB" {
+		t.Errorf("unexpected previous key %+v", keys[1])
+	}
+}
@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// DefaultRevocationTTL is how long looked up revocation state is trusted.
+// Revocations made by another server instance take up to this long to apply.
+const DefaultRevocationTTL = 30 * time.Second
+
+// RevocationCache answers whether an access token was revoked after it was
+// issued, without a database round trip on every request. A token is revoked
+// if it was issued before the user's sessions-valid-after time, or if the
+// session it was issued for has ended.
+//
+// The loaders are injected so the cache does not depend on the database
+// package. ValidAfter returns the zero time if the user never revoked their
+// tokens; both loaders return an error for unknown users and sessions, which
+// revokes the token.
+type RevocationCache struct {
+	ValidAfter     func(ctx context.Context, userID uuid.UUID) (time.Time, error)
+	SessionRevoked func(ctx context.Context, sessionID uuid.UUID) (bool, error)
+	TTL            time.Duration
+	Now            func() time.Time
+
+	mu       sync.Mutex
+	users    map[uuid.UUID]cached[time.Time]
+	sessions map[uuid.UUID]cached[bool]
+}
+
+// maxCachedEntries bounds each cache map; expired entries are dropped once
+// it is reached.
+const maxCachedEntries = 10000
+
+type cached[T any] struct {
+	value   T
+	expires time.Time
+}
+
+func NewRevocationCache(
+	validAfter func(ctx context.Context, userID uuid.UUID) (time.Time, error),
+	sessionRevoked func(ctx context.Context, sessionID uuid.UUID) (bool, error),
+) *RevocationCache {
+	return &RevocationCache{
+		ValidAfter:     validAfter,
+		SessionRevoked: sessionRevoked,
+		TTL:            DefaultRevocationTTL,
+		Now:            time.Now,
+		users:          map[uuid.UUID]cached[time.Time]{},
+		sessions:       map[uuid.UUID]cached[bool]{},
+	}
+}
+
+// Check returns ErrTokenRevoked if a token for userID and sessionID issued at
+// issuedAt is no longer valid. sessionID may be uuid.Nil.
+func (c *RevocationCache) Check(ctx context.Context, userID, sessionID uuid.UUID, issuedAt time.Time) error {
+	validAfter, err := lookup(ctx, c, c.users, userID, c.ValidAfter)
+	if err != nil {
+		return ErrTokenRevoked
+	}
+	if issuedAt.Before(validAfter) {
+		return ErrTokenRevoked
+	}
+
+	if sessionID == uuid.Nil {
+		return nil
+	}
+	revoked, err := lookup(ctx, c, c.sessions, sessionID, c.SessionRevoked)
+	if err != nil || revoked {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// ForgetUser drops the cached state of userID so that a revocation made by
+// this instance applies immediately.
+func (c *RevocationCache) ForgetUser(userID uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.users, userID)
+}
+
+// ForgetSession is ForgetUser for a session.
+func (c *RevocationCache) ForgetSession(sessionID uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.sessions, sessionID)
+}
+
+// ForgetAll drops all cached state.
+func (c *RevocationCache) ForgetAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.users)
+	clear(c.sessions)
+}
+
+func lookup[T any](ctx context.Context, c *RevocationCache, m map[uuid.UUID]cached[T], id uuid.UUID, load func(context.Context, uuid.UUID) (T, error)) (T, error) {
+	now := c.Now()
+
+	c.mu.Lock()
+	entry, ok := m[id]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.value, nil
+	}
+
+	value, err := load(ctx, id)
+	if err != nil {
+		return value, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(m) >= maxCachedEntries {
+		for k, e := range m {
+			if !now.Before(e.expires) {
+				delete(m, k)
+			}
+		}
+		if len(m) >= maxCachedEntries {
+			clear(m)
+		}
+	}
+	m[id] = cached[T]{value: value, expires: now.Add(c.TTL)}
+	return value, nil
+}
@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRevocationCacheCheck(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	userID := uuid.New()
+	revokedUserID := uuid.New()
+	activeSession := uuid.New()
+	endedSession := uuid.New()
+
+	cache := NewRevocationCache(
+		func(ctx context.Context, id uuid.UUID) (time.Time, error) {
+			switch id {
+			case userID:
+				return time.Time{}, nil
+			case revokedUserID:
+				return now, nil
+			}
+			return time.Time{}, sql.ErrNoRows
+		},
+		func(ctx context.Context, id uuid.UUID) (bool, error) {
+			switch id {
+			case activeSession:
+				return false, nil
+			case endedSession:
+				return true, nil
+			}
+			return false, sql.ErrNoRows
+		},
+	)
+
+	cases := []struct {
+		name        string
+		userID      uuid.UUID
+		sessionID   uuid.UUID
+		issuedAt    time.Time
+		expectError bool
+	}{
+		{name: "never revoked", userID: userID, issuedAt: now},
+		{name: "active session", userID: userID, sessionID: activeSession, issuedAt: now},
+		{name: "ended session", userID: userID, sessionID: endedSession, issuedAt: now, expectError: true},
+		{name: "unknown session", userID: userID, sessionID: uuid.New(), issuedAt: now, expectError: true},
+		{name: "issued before revocation", userID: revokedUserID, issuedAt: now.Add(-time.Minute), expectError: true},
+		{name: "issued in the revocation second", userID: revokedUserID, issuedAt: now},
+		{name: "issued after revocation", userID: revokedUserID, issuedAt: now.Add(time.Minute)},
+		{name: "unknown user", userID: uuid.New(), issuedAt: now, expectError: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := cache.Check(context.Background(), tc.userID, tc.sessionID, tc.issuedAt)
+			if tc.expectError && !errors.Is(err, ErrTokenRevoked) {
+				t.Errorf("expected ErrTokenRevoked, got %v", err)
+			}
+			if !tc.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestRevocationCacheTTL(t *testing.T) {
+	now := time.Now()
+	userID := uuid.New()
+	validAfter := time.Time{}
+	loads := 0
+
+	cache := NewRevocationCache(
+		func(ctx context.Context, id uuid.UUID) (time.Time, error) {
+			loads++
+			return validAfter, nil
+		},
+		func(ctx context.Context, id uuid.UUID) (bool, error) {
+			return false, nil
+		},
+	)
+	cache.Now = func() time.Time { return now }
+
+	issuedAt := now.Add(-time.Minute)
+	for range 3 {
+		if err := cache.Check(context.Background(), userID, uuid.Nil, issuedAt); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("expected 1 load within TTL, got %d", loads)
+	}
+
+	// Another instance revokes the user's tokens: the cached state is used
+	// until it expires.
+	validAfter = now
+	if err := cache.Check(context.Background(), userID, uuid.Nil, issuedAt); err != nil {
+		t.Errorf("expected cached state within TTL, got %v", err)
+	}
+
+	now = now.Add(DefaultRevocationTTL)
+	if err := cache.Check(context.Background(), userID, uuid.Nil, issuedAt); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("expected ErrTokenRevoked after TTL, got %v", err)
+	}
+
+	// A revocation by this instance applies at once.
+	validAfter = time.Time{}
+	cache.ForgetUser(userID)
+	if err := cache.Check(context.Background(), userID, uuid.Nil, issuedAt); err != nil {
+		t.Errorf("expected fresh state after ForgetUser, got %v", err)
+	}
+}
+
+func TestValidateRevoked(t *testing.T) {
+	ks := NewHMACKeySet("mysecretkey")
+	userID := uuid.New()
+	sessionID := uuid.New()
+
+	token, err := ks.MakeAccessToken(Claims{UserID: userID, SessionID: sessionID}, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to create token: %v", err)
+	}
+
+	revoked := false
+	cache := NewRevocationCache(
+		func(ctx context.Context, id uuid.UUID) (time.Time, error) {
+			return time.Time{}, nil
+		},
+		func(ctx context.Context, id uuid.UUID) (bool, error) {
+			return revoked, nil
+		},
+	)
+
+	if _, err := ks.Validate(token, WithRevocationCheck(context.Background(), cache)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	revoked = true
+	cache.ForgetSession(sessionID)
+	if _, err := ks.Validate(token, WithRevocationCheck(context.Background(), cache)); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("expected ErrTokenRevoked, got %v", err)
+	}
+
+	// Without the option only the signature and expiry are checked.
+	if _, err := ks.Validate(token); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package chirptext
+
+import (
+	"crypto/rand"
+	"errors"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rivo/uniseg"
+	"golang.org/x/text/unicode/norm"
+)
+
+// URLLength is the fixed weight of every link, whatever its real length.
+const URLLength = 23
+
+// Entity is a URL found in a chirp body. Start and End are offsets in
+// Unicode code points, End being exclusive.
+type Entity struct {
+	Start int
+	End   int
+	URL   string
+}
+
+var urlPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"]+`)
+
+// ExtractURLs returns the links in body in the order they appear.
+// Trailing punctuation is not considered part of a link.
+func ExtractURLs(body string) []Entity {
+	var entities []Entity
+
+	for _, loc := range urlPattern.FindAllStringIndex(body, -1) {
+		raw := strings.TrimRight(body[loc[0]:loc[1]], ".,:;!?'\")]}")
+		if strings.EqualFold(raw, "www.") || strings.HasSuffix(strings.ToLower(raw), "://") {
+			continue
+		}
+
+		start := utf8.RuneCountInString(body[:loc[0]])
+		entities = append(entities, Entity{
+			Start: start,
+			End:   start + utf8.RuneCountInString(raw),
+			URL:   raw,
+		})
+	}
+
+	return entities
+}
+
+var (
+	ErrEmpty            = errors.New("Chirp is empty")
+	ErrControlCharacter = errors.New("Chirp contains control characters")
+	ErrBidiOverride     = errors.New("Chirp contains bidirectional override characters")
+)
+
+// Normalize prepares user-supplied text for storage. It converts the text to
+// NFC, turns CRLF and lone CR line breaks into LF, rejects control and bidi
+// override characters, and trims whitespace and invisible padding from both
+// ends. Every path that writes chirp text must go through Normalize so stored
+// text and lengths stay comparable.
+func Normalize(body string) (string, error) {
+	body = norm.NFC.String(body)
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+	body = strings.ReplaceAll(body, "\r", "\n")
+
+	for _, r := range body {
+		if isBidiOverride(r) {
+			return "", ErrBidiOverride
+		}
+		if unicode.IsControl(r) && r != '\n' && r != '\t' {
+			return "", ErrControlCharacter
+		}
+	}
+
+	body = strings.TrimFunc(body, isPadding)
+	if body == "" {
+		return "", ErrEmpty
+	}
+
+	return body, nil
+}
+
+// isBidiOverride reports whether r is an explicit embedding, override or
+// isolate, which can be used to make text render differently from how it
+// is stored.
+func isBidiOverride(r rune) bool {
+	return (r >= '\u202A' && r <= '\u202E') || (r >= '\u2066' && r <= '\u2069')
+}
+
+// isPadding reports whether r renders as blank space.
+func isPadding(r rune) bool {
+	if unicode.IsSpace(r) {
+		return true
+	}
+
+	switch r {
+	case '\u00AD', // soft hyphen
+		'\u115F', '\u1160', '\u3164', '\uFFA0', // hangul fillers
+		'\u180E',                               // mongolian vowel separator
+		'\u200B', '\u200C', '\u200D', '\u2060', // zero width characters
+		'\u200E', '\u200F', // directional marks
+		'\u2800', // braille blank
+		'\uFEFF': // byte order mark
+		return true
+	}
+
+	return false
+}
+
+// Length returns the number of user-perceived characters (grapheme clusters)
+// in body, where each link counts as URLLength characters.
+func Length(body string) int {
+	n := uniseg.GraphemeClusterCount(body)
+	for _, e := range ExtractURLs(body) {
+		n += URLLength - uniseg.GraphemeClusterCount(e.URL)
+	}
+	return n
+}
+
+// Href returns the absolute URL a link entity should redirect to.
+func Href(url string) string {
+	lower := strings.ToLower(url)
+	if strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") {
+		return url
+	}
+	return "http://" + url
+}
+
+const codeAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// maxUnbiasedByte is the largest multiple of len(codeAlphabet) a byte can
+// hold. Bytes from it up are discarded so every character is equally likely.
+const maxUnbiasedByte = 256 - 256%len(codeAlphabet)
+
+// MakeShortCode returns a random code for use in short links.
+func MakeShortCode() (string, error) {
+	code := make([]byte, 0, 8)
+	buf := make([]byte, 16)
+	for len(code) < cap(code) {
+		if _, err := rand.Read(buf); err != nil {
+			return "", errors.New("failed to generate random bytes for short code")
+		}
+		for _, b := range buf {
+			if int(b) >= maxUnbiasedByte || len(code) == cap(code) {
+				continue
+			}
+			code = append(code, codeAlphabet[int(b)%len(codeAlphabet)])
+		}
+	}
+
+	return string(code), nil
+}
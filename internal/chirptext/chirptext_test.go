@@ -0,0 +1,210 @@
+package chirptext
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExtractURLs(t *testing.T) {
+	cases := []struct {
+		name   string
+		body   string
+		expect []Entity
+	}{
+		{
+			name:   "no links",
+			body:   "just a chirp",
+			expect: nil,
+		},
+		{
+			name:   "https link",
+			body:   "read https://example.com/a?b=c now",
+			expect: []Entity{{Start: 5, End: 30, URL: "https://example.com/a?b=c"}},
+		},
+		{
+			name:   "trailing punctuation",
+			body:   "see www.example.com.",
+			expect: []Entity{{Start: 4, End: 19, URL: "www.example.com"}},
+		},
+		{
+			name:   "offsets count code points",
+			body:   "🐦🐦 http://a.io",
+			expect: []Entity{{Start: 3, End: 14, URL: "http://a.io"}},
+		},
+		{
+			name: "multiple links",
+			body: "http://a.io and https://b.io",
+			expect: []Entity{
+				{Start: 0, End: 11, URL: "http://a.io"},
+				{Start: 16, End: 28, URL: "https://b.io"},
+			},
+		},
+		{
+			name:   "scheme only",
+			body:   "http:// is not a link",
+			expect: nil,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := ExtractURLs(tc.body)
+			if len(got) != len(tc.expect) {
+				t.Fatalf("expected %d entities, got %d: %v", len(tc.expect), len(got), got)
+			}
+			for i := range got {
+				if got[i] != tc.expect[i] {
+					t.Errorf("entity %d: expected %+v, got %+v", i, tc.expect[i], got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLength(t *testing.T) {
+	longURL := "https://example.com/" + strings.Repeat("a", 200)
+
+	cases := []struct {
+		name   string
+		body   string
+		expect int
+	}{
+		{name: "plain text", body: "hello", expect: 5},
+		{name: "short link", body: "http://a.io", expect: URLLength},
+		{name: "long link", body: "look " + longURL, expect: 5 + URLLength},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Length(tc.body); got != tc.expect {
+				t.Errorf("expected length %d, got %d", tc.expect, got)
+			}
+		})
+	}
+}
+
+func TestLengthScripts(t *testing.T) {
+	cases := []struct {
+		name   string
+		body   string
+		expect int
+	}{
+		{name: "latin", body: "h\u00e9llo", expect: 5},
+		{name: "combining accent", body: "e\u0301", expect: 1},
+		{name: "emoji", body: "\U0001F426\U0001F426\U0001F426", expect: 3},
+		{name: "zwj family", body: "\U0001F469\u200D\U0001F469\u200D\U0001F467\u200D\U0001F466", expect: 1},
+		{name: "skin tone", body: "\U0001F44D\U0001F3FD", expect: 1},
+		{name: "flag", body: "\U0001F1EE\U0001F1F3", expect: 1},
+		// Conjuncts split after the virama until Unicode 15.1 (rule GB9c).
+		{name: "hindi", body: "\u0928\u092E\u0938\u094D\u0924\u0947", expect: 4},
+		{name: "arabic", body: "\u0645\u0631\u062D\u0628\u0627", expect: 5},
+		{name: "chinese", body: "\u4F60\u597D\u4E16\u754C", expect: 4},
+		{name: "korean jamo", body: "\u1112\u1161\u11AB", expect: 1},
+		{name: "thai", body: "\u0E2A\u0E27\u0E31\u0E2A\u0E14\u0E35", expect: 4},
+		{name: "emoji with link", body: "\U0001F426 https://example.com/" + strings.Repeat("x", 50), expect: 2 + URLLength},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Length(tc.body); got != tc.expect {
+				t.Errorf("expected length %d, got %d", tc.expect, got)
+			}
+		})
+	}
+}
+
+func TestLengthLimit(t *testing.T) {
+	const limit = 140
+	family := "\U0001F469\u200D\U0001F469\u200D\U0001F467\u200D\U0001F466"
+
+	cases := []struct {
+		name   string
+		body   string
+		expect bool
+	}{
+		{name: "140 emoji", body: strings.Repeat("\U0001F426", 140), expect: true},
+		{name: "141 emoji", body: strings.Repeat("\U0001F426", 141), expect: false},
+		{name: "140 hindi syllables", body: strings.Repeat("\u0928\u092E", 70), expect: true},
+		{name: "140 families", body: strings.Repeat(family, 140), expect: true},
+		{name: "141 ascii", body: strings.Repeat("a", 141), expect: false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Length(tc.body) <= limit; got != tc.expect {
+				t.Errorf("expected fits=%v, got %v (length %d)", tc.expect, got, Length(tc.body))
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	cases := []struct {
+		name      string
+		body      string
+		expect    string
+		expectErr error
+	}{
+		{name: "plain", body: "hello", expect: "hello"},
+		{name: "nfc latin", body: "cafe\u0301", expect: "caf\u00e9"},
+		{name: "nfc hangul", body: "\u1112\u1161\u11AB", expect: "\uD55C"},
+		{name: "hindi unchanged", body: "\u0928\u092E\u0938\u094D\u0924\u0947", expect: "\u0928\u092E\u0938\u094D\u0924\u0947"},
+		{name: "arabic unchanged", body: "\u0645\u0631\u062D\u0628\u0627", expect: "\u0645\u0631\u062D\u0628\u0627"},
+		{name: "emoji zwj kept", body: "\U0001F469\u200D\U0001F4BB", expect: "\U0001F469\u200D\U0001F4BB"},
+		{name: "trims whitespace", body: "  hi \n", expect: "hi"},
+		{name: "trims invisible padding", body: "\u200B\uFEFFhi\u2060\u3164", expect: "hi"},
+		{name: "keeps inner newline", body: "line one\nline two", expect: "line one\nline two"},
+		{name: "crlf to lf", body: "line one\r\nline two", expect: "line one\nline two"},
+		{name: "lone cr to lf", body: "line one\rline two\r\n", expect: "line one\nline two"},
+		{name: "empty", body: "", expectErr: ErrEmpty},
+		{name: "only padding", body: " \u200B\u3164 ", expectErr: ErrEmpty},
+		{name: "null byte", body: "hi\x00there", expectErr: ErrControlCharacter},
+		{name: "escape sequence", body: "hi\x1b[31m", expectErr: ErrControlCharacter},
+		{name: "c1 control", body: "hi\u0085there", expectErr: ErrControlCharacter},
+		{name: "rtl override", body: "evil\u202Etxt.exe", expectErr: ErrBidiOverride},
+		{name: "rtl isolate", body: "a\u2067b\u2069", expectErr: ErrBidiOverride},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Normalize(tc.body)
+			if tc.expectErr != nil {
+				if err != tc.expectErr {
+					t.Errorf("expected error %v, got %v", tc.expectErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			if got != tc.expect {
+				t.Errorf("expected %q, got %q", tc.expect, got)
+			}
+		})
+	}
+}
+
+func TestMakeShortCode(t *testing.T) {
+	if maxUnbiasedByte%len(codeAlphabet) != 0 || maxUnbiasedByte > 256 || 256-maxUnbiasedByte >= len(codeAlphabet) {
+		t.Fatalf("maxUnbiasedByte %d is not the largest multiple of %d", maxUnbiasedByte, len(codeAlphabet))
+	}
+
+	seen := make(map[string]bool)
+	for range 100 {
+		code, err := MakeShortCode()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(code) != 8 {
+			t.Errorf("expected 8 characters, got %q", code)
+		}
+		if strings.Trim(code, codeAlphabet) != "" {
+			t.Errorf("expected only alphabet characters, got %q", code)
+		}
+		if seen[code] {
+			t.Errorf("got %q twice", code)
+		}
+		seen[code] = true
+	}
+}
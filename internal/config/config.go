@@ -1,43 +1,368 @@
 package config
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"log"
+	"net/smtp"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"sync/atomic"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
+	"github.com/karprabha/chirpy/internal/auth"
 	"github.com/karprabha/chirpy/internal/database"
+	"github.com/karprabha/chirpy/internal/entitlements"
+	"github.com/karprabha/chirpy/internal/loginthrottle"
+	"github.com/karprabha/chirpy/internal/mailer"
+	"github.com/karprabha/chirpy/internal/moderation"
+	"github.com/karprabha/chirpy/internal/passwordpolicy"
+	"github.com/karprabha/chirpy/internal/webauthn"
 	_ "github.com/lib/pq"
 )
 
 type Config struct {
-	DB             *sql.DB
-	Queries        *database.Queries
-	FileServerHits atomic.Int32
-	Platform       string
-	JWTSecret      string
-	PolkaKey       string
+	DB                   *sql.DB
+	Queries              *database.Queries
+	FileServerHits       atomic.Int32
+	Platform             string
+	JWTKeys              *auth.KeySet
+	PolkaKey             string
+	PolkaSigningSecrets  []string
+	AdminBootstrapToken  string
+	ModerationMode       moderation.Mode
+	BaseURL              string
+	Tiers                entitlements.Config
+	RedPeriod            time.Duration
+	WebhookMaxAge        time.Duration
+	Revocations          *auth.RevocationCache
+	WebAuthn             *webauthn.RelyingParty
+	Mailer               mailer.Mailer
+	AppURL               string
+	RequireVerifiedEmail bool
+	PasswordPolicy       *passwordpolicy.Policy
+	AccountLoginLimits   loginthrottle.Limits
+	IPLoginLimits        loginthrottle.Limits
+	ResetEmailLimits     loginthrottle.Limits
+	ResetIPLimits        loginthrottle.Limits
+	AllowPrivateWebhooks bool
 }
 
 func New() *Config {
 	godotenv.Load()
 	dbURL := os.Getenv("DB_URL")
 	platform := os.Getenv("PLATFORM")
-	jwtSecret := os.Getenv("JWT_SECRET")
 	polkaKey := os.Getenv("POLKA_KEY")
+	polkaSigningSecrets := splitList(os.Getenv("POLKA_SIGNING_SECRETS"))
+	if polkaKey == "" && len(polkaSigningSecrets) == 0 {
+		log.Fatal("POLKA_KEY or POLKA_SIGNING_SECRETS is required to authenticate Polka webhooks")
+	}
+	adminBootstrapToken := os.Getenv("ADMIN_BOOTSTRAP_TOKEN")
+	moderationMode := moderation.ParseMode(os.Getenv("MODERATION_MODE"))
+	baseURL := strings.TrimSuffix(os.Getenv("BASE_URL"), "/")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+
+	appURL := strings.TrimSuffix(os.Getenv("APP_URL"), "/")
+	if appURL == "" {
+		appURL = baseURL
+	}
+	requireVerifiedEmail := os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true"
+	// Outbound webhooks may only reach loopback and private addresses when
+	// testing locally.
+	allowPrivateWebhooks := os.Getenv("WEBHOOK_ALLOW_PRIVATE_TARGETS") == "true"
+
+	redPeriod := 30 * 24 * time.Hour
+	if v := os.Getenv("RED_PERIOD"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatal("Invalid RED_PERIOD:", err)
+		}
+		redPeriod = d
+	}
+
+	webhookMaxAge := 72 * time.Hour
+	if v := os.Getenv("WEBHOOK_MAX_AGE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatal("Invalid WEBHOOK_MAX_AGE:", err)
+		}
+		webhookMaxAge = d
+	}
+
+	jwtKeys, err := loadJWTKeys()
+	if err != nil {
+		log.Fatal("Failed to load JWT keys:", err)
+	}
+
+	relyingParty, err := loadRelyingParty(baseURL)
+	if err != nil {
+		log.Fatal("Invalid WebAuthn settings:", err)
+	}
+
+	m, err := loadMailer(platform)
+	if err != nil {
+		log.Fatal("Invalid mailer settings:", err)
+	}
+
+	passwordPolicy, err := loadPasswordPolicy()
+	if err != nil {
+		log.Fatal("Invalid password policy:", err)
+	}
+
+	accountLoginLimits, ipLoginLimits, err := loadLoginLimits()
+	if err != nil {
+		log.Fatal("Invalid login limits:", err)
+	}
+	resetEmailLimits, resetIPLimits := loginthrottle.ResetDefault()
+
+	tiers, err := entitlements.Load(os.Getenv("TIERS_FILE"))
+	if err != nil {
+		log.Fatal("Failed to load tier limits:", err)
+	}
 
 	db, err := sql.Open("postgres", dbURL)
 	if err != nil {
 		log.Fatal("Failed to connect to DB:", err)
 	}
 
+	queries := database.New(db)
+
 	return &Config{
-		DB:             db,
-		Queries:        database.New(db),
-		FileServerHits: atomic.Int32{},
-		Platform:       platform,
-		JWTSecret:      jwtSecret,
-		PolkaKey:       polkaKey,
+		DB:                   db,
+		Queries:              queries,
+		FileServerHits:       atomic.Int32{},
+		Platform:             platform,
+		JWTKeys:              jwtKeys,
+		PolkaKey:             polkaKey,
+		PolkaSigningSecrets:  polkaSigningSecrets,
+		AdminBootstrapToken:  adminBootstrapToken,
+		ModerationMode:       moderationMode,
+		BaseURL:              baseURL,
+		Tiers:                tiers,
+		RedPeriod:            redPeriod,
+		WebhookMaxAge:        webhookMaxAge,
+		Revocations:          newRevocationCache(queries),
+		WebAuthn:             relyingParty,
+		Mailer:               m,
+		AppURL:               appURL,
+		RequireVerifiedEmail: requireVerifiedEmail,
+		PasswordPolicy:       passwordPolicy,
+		AccountLoginLimits:   accountLoginLimits,
+		IPLoginLimits:        ipLoginLimits,
+		ResetEmailLimits:     resetEmailLimits,
+		ResetIPLimits:        resetIPLimits,
+		AllowPrivateWebhooks: allowPrivateWebhooks,
+	}
+}
+
+// newRevocationCache checks access tokens against the users'
+// sessions_valid_after and the revoked_at of the session they belong to.
+func newRevocationCache(q *database.Queries) *auth.RevocationCache {
+	return auth.NewRevocationCache(
+		func(ctx context.Context, userID uuid.UUID) (time.Time, error) {
+			validAfter, err := q.GetUserSessionsValidAfter(ctx, userID)
+			if err != nil {
+				return time.Time{}, err
+			}
+			return validAfter.Time, nil
+		},
+		func(ctx context.Context, sessionID uuid.UUID) (bool, error) {
+			revokedAt, err := q.GetSessionRevokedAt(ctx, sessionID)
+			if err != nil {
+				return false, err
+			}
+			return revokedAt.Valid, nil
+		},
+	)
+}
+
+// loadJWTKeys builds the access token key set. JWT_SIGNING_KEY_FILE is the PEM
+// private key new tokens are signed with, and JWT_VERIFICATION_KEY_FILES lists
+// keys that are still accepted, such as the previous signing key during a
+// rotation. JWT_SECRET signs tokens if there is no signing key, and otherwise
+// keeps HS256 tokens valid until it is unset. JWT_ISSUER and JWT_AUDIENCE
+// override the iss and aud claims.
+func loadJWTKeys() (*auth.KeySet, error) {
+	var signing *auth.Key
+	if path := os.Getenv("JWT_SIGNING_KEY_FILE"); path != "" {
+		k, err := readKey(path)
+		if err != nil {
+			return nil, err
+		}
+		signing = k
+	}
+
+	var verify []*auth.Key
+	for _, path := range splitList(os.Getenv("JWT_VERIFICATION_KEY_FILES")) {
+		k, err := readKey(path)
+		if err != nil {
+			return nil, err
+		}
+		verify = append(verify, k)
+	}
+
+	ks, err := auth.NewKeySet(signing, verify, os.Getenv("JWT_SECRET"))
+	if err != nil {
+		return nil, err
+	}
+	if v := os.Getenv("JWT_ISSUER"); v != "" {
+		ks.Issuer = v
+	}
+	if v := os.Getenv("JWT_AUDIENCE"); v != "" {
+		ks.Audience = v
+	}
+	return ks, nil
+}
+
+// loadRelyingParty configures passkeys. WEBAUTHN_RP_ID is the domain passkeys
+// are registered for and WEBAUTHN_ORIGINS lists the origins the web app is
+// served from; both default to BASE_URL. WEBAUTHN_RP_NAME is shown by the
+// authenticator.
+func loadRelyingParty(baseURL string) (*webauthn.RelyingParty, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	rp := &webauthn.RelyingParty{
+		ID:      u.Hostname(),
+		Name:    "Chirpy",
+		Origins: []string{u.Scheme + "://" + u.Host},
+	}
+	if v := os.Getenv("WEBAUTHN_RP_ID"); v != "" {
+		rp.ID = v
+	}
+	if v := os.Getenv("WEBAUTHN_RP_NAME"); v != "" {
+		rp.Name = v
+	}
+	if v := splitList(os.Getenv("WEBAUTHN_ORIGINS")); len(v) > 0 {
+		rp.Origins = v
+	}
+	if rp.ID == "" {
+		return nil, fmt.Errorf("no RP ID in BASE_URL %q", baseURL)
+	}
+	return rp, nil
+}
+
+// loadMailer picks how account emails are delivered. MAILER is "smtp" to
+// send through SMTP_ADDR, authenticating with SMTP_USERNAME and
+// SMTP_PASSWORD if set; "file" to write messages to MAIL_DIR; or "log" to
+// print them. MAIL_FROM is the sender address. The log and file mailers keep
+// reset and confirmation links where other people may read them, so they are
+// only allowed when platform is "dev", where "log" is the default.
+func loadMailer(platform string) (mailer.Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "Chirpy <no-reply@localhost>"
+	}
+
+	kind := os.Getenv("MAILER")
+	if platform != "dev" && kind != "smtp" {
+		return nil, fmt.Errorf("MAILER=smtp is required unless PLATFORM=dev")
+	}
+
+	switch kind {
+	case "", "log":
+		return &mailer.Log{From: from}, nil
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		return &mailer.File{From: from, Dir: dir}, nil
+	case "smtp":
+		addr := os.Getenv("SMTP_ADDR")
+		if addr == "" {
+			return nil, fmt.Errorf("SMTP_ADDR is required for MAILER=smtp")
+		}
+		m := &mailer.SMTP{Addr: addr, From: from}
+		if user := os.Getenv("SMTP_USERNAME"); user != "" {
+			host, _, _ := strings.Cut(addr, ":")
+			m.Auth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), host)
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("unknown MAILER %q", kind)
+	}
+}
+
+// loadPasswordPolicy reads the rules new passwords must follow.
+// PASSWORD_MIN_LENGTH is the minimum number of characters, 8 by default.
+// BREACHED_PASSWORDS_FILE, if set, is a sorted list of SHA-1 hashes of
+// breached passwords, such as the Pwned Passwords download, that are
+// refused.
+func loadPasswordPolicy() (*passwordpolicy.Policy, error) {
+	p := &passwordpolicy.Policy{MinLength: passwordpolicy.DefaultMinLength}
+	if v := os.Getenv("PASSWORD_MIN_LENGTH"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid PASSWORD_MIN_LENGTH %q", v)
+		}
+		p.MinLength = n
+	}
+
+	if path := os.Getenv("BREACHED_PASSWORDS_FILE"); path != "" {
+		hf, err := passwordpolicy.OpenHashFile(path)
+		if err != nil {
+			return nil, err
+		}
+		p.Breached = hf
+	}
+	return p, nil
+}
+
+// loadLoginLimits reads how failed logins are throttled. An account is
+// locked for LOGIN_LOCKOUT, 15 minutes by default, after LOGIN_MAX_FAILURES
+// failed logins, 10 by default.
+func loadLoginLimits() (account, ip loginthrottle.Limits, err error) {
+	account, ip = loginthrottle.Default()
+	if v := os.Getenv("LOGIN_MAX_FAILURES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return account, ip, fmt.Errorf("invalid LOGIN_MAX_FAILURES %q", v)
+		}
+		account.MaxFailures = n
+		account.FreeFailures = min(account.FreeFailures, n-1)
+	}
+	if v := os.Getenv("LOGIN_LOCKOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return account, ip, fmt.Errorf("invalid LOGIN_LOCKOUT %q", v)
+		}
+		// Remember failures long enough after a lockout ends that the next
+		// failure locks the account again.
+		account.Lockout = d
+		account.Window = max(account.Window, 4*d)
+	}
+	return account, ip, nil
+}
+
+func readKey(path string) (*auth.Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	k, err := auth.ParseKey(data, "")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return k, nil
+}
+
+// splitList splits a comma-separated environment value, dropping blanks.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
+	return items
 }
@@ -7,23 +7,43 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
 )
 
+const countChirpsByAuthorInLastHour = `-- name: CountChirpsByAuthorInLastHour :one
+SELECT COUNT(*) FROM chirps
+WHERE user_id = $1 AND created_at > NOW() - INTERVAL '1 hour'
+`
+
+func (q *Queries) CountChirpsByAuthorInLastHour(ctx context.Context, userID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countChirpsByAuthorInLastHour, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, body, user_id, created_at, updated_at)
-VALUES (gen_random_uuid(), $1, $2, NOW(), NOW())
-RETURNING id, body, user_id, created_at, updated_at
+INSERT INTO chirps (id, body, user_id, content_warning, sensitive, created_at, updated_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, NOW(), NOW())
+RETURNING id, body, user_id, created_at, updated_at, content_warning, sensitive
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body           string
+	UserID         uuid.UUID
+	ContentWarning sql.NullString
+	Sensitive      bool
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.Body,
+		arg.UserID,
+		arg.ContentWarning,
+		arg.Sensitive,
+	)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -31,6 +51,8 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UserID,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.ContentWarning,
+		&i.Sensitive,
 	)
 	return i, err
 }
@@ -46,7 +68,7 @@ func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
 }
 
 const getChirp = `-- name: GetChirp :one
-SELECT id, body, user_id, created_at, updated_at FROM chirps
+SELECT id, body, user_id, created_at, updated_at, content_warning, sensitive FROM chirps
 WHERE id = $1
 `
 
@@ -59,12 +81,14 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.UserID,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.ContentWarning,
+		&i.Sensitive,
 	)
 	return i, err
 }
 
 const getChirps = `-- name: GetChirps :many
-SELECT id, body, user_id, created_at, updated_at FROM chirps
+SELECT id, body, user_id, created_at, updated_at, content_warning, sensitive FROM chirps
 ORDER BY created_at ASC
 `
 
@@ -83,6 +107,8 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UserID,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.ContentWarning,
+			&i.Sensitive,
 		); err != nil {
 			return nil, err
 		}
@@ -98,7 +124,7 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 }
 
 const getChirpsByAuthorID = `-- name: GetChirpsByAuthorID :many
-SELECT id, body, user_id, created_at, updated_at FROM chirps
+SELECT id, body, user_id, created_at, updated_at, content_warning, sensitive FROM chirps
 WHERE user_id = $1
 ORDER BY created_at ASC
 `
@@ -118,6 +144,8 @@ func (q *Queries) GetChirpsByAuthorID(ctx context.Context, userID uuid.UUID) ([]
 			&i.UserID,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.ContentWarning,
+			&i.Sensitive,
 		); err != nil {
 			return nil, err
 		}
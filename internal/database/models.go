@@ -6,33 +6,210 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type Chirp struct {
-	ID        uuid.UUID
-	Body      string
+	ID             uuid.UUID
+	Body           string
+	UserID         uuid.UUID
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	ContentWarning sql.NullString
+	Sensitive      bool
+}
+
+type EmailChangeToken struct {
+	TokenHash string
 	UserID    uuid.UUID
+	OldEmail  string
+	NewEmail  string
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
 	CreatedAt time.Time
-	UpdatedAt time.Time
 }
 
-type RefreshToken struct {
-	Token     string
+type Link struct {
+	ID         uuid.UUID
+	ChirpID    uuid.UUID
+	Code       string
+	Url        string
+	StartIndex int32
+	EndIndex   int32
+	Clicks     int64
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+type LoginThrottle struct {
+	Kind         string
+	Subject      string
+	FailureCount int32
+	LastFailedAt time.Time
+	LockedUntil  sql.NullTime
+}
+
+type MfaChallenge struct {
+	TokenHash string
+	UserID    uuid.UUID
+	Attempts  int32
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+	CreatedAt time.Time
+}
+
+type PasswordResetToken struct {
+	TokenHash string
 	UserID    uuid.UUID
 	ExpiresAt time.Time
-	RevokedAt sql.NullTime
+	UsedAt    sql.NullTime
+	CreatedAt time.Time
+}
+
+type Poll struct {
+	ID        uuid.UUID
+	ChirpID   uuid.UUID
+	ExpiresAt time.Time
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
 
+type PollOption struct {
+	ID       uuid.UUID
+	PollID   uuid.UUID
+	Position int32
+	Text     string
+}
+
+type PollVote struct {
+	PollID    uuid.UUID
+	UserID    uuid.UUID
+	OptionID  uuid.UUID
+	CreatedAt time.Time
+}
+
+type RecoveryCode struct {
+	UserID    uuid.UUID
+	CodeHash  string
+	UsedAt    sql.NullTime
+	CreatedAt time.Time
+}
+
+type RefreshToken struct {
+	TokenHash  string
+	UserID     uuid.UUID
+	ExpiresAt  time.Time
+	RevokedAt  sql.NullTime
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	FamilyID   uuid.UUID
+	ReplacedBy sql.NullString
+}
+
+type Session struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	UserAgent  string
+	Ip         string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	RevokedAt  sql.NullTime
+}
+
+type SubscriptionHistory struct {
+	ID           uuid.UUID
+	UserID       uuid.UUID
+	Event        string
+	IsChirpyRed  bool
+	RedExpiresAt sql.NullTime
+	CreatedAt    time.Time
+}
+
 type User struct {
+	ID                  uuid.UUID
+	Email               string
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	HashedPassword      string
+	IsChirpyRed         bool
+	ExpandSensitive     bool
+	RedExpiresAt        sql.NullTime
+	SubscriptionEventAt sql.NullTime
+	SessionsValidAfter  sql.NullTime
+	Role                string
+	EmailVerifiedAt     sql.NullTime
+}
+
+type UserTotp struct {
+	UserID       uuid.UUID
+	Secret       string
+	ConfirmedAt  sql.NullTime
+	LastUsedStep sql.NullInt64
+	CreatedAt    time.Time
+}
+
+type WebauthnChallenge struct {
+	ID        uuid.UUID
+	UserID    uuid.NullUUID
+	Ceremony  string
+	Challenge []byte
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+type WebauthnCredential struct {
+	ID           uuid.UUID
+	UserID       uuid.UUID
+	CredentialID []byte
+	PublicKey    []byte
+	SignCount    int64
+	Name         string
+	CreatedAt    time.Time
+	LastUsedAt   sql.NullTime
+}
+
+type WebhookDelivery struct {
 	ID             uuid.UUID
-	Email          string
+	EndpointID     uuid.UUID
+	EventID        uuid.UUID
+	EventType      string
+	Payload        json.RawMessage
+	Status         string
+	Attempts       int32
+	NextAttemptAt  time.Time
+	LastAttemptAt  sql.NullTime
+	ResponseStatus sql.NullInt32
+	Error          sql.NullString
 	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	HashedPassword string
-	IsChirpyRed    bool
+	DeliveredAt    sql.NullTime
+}
+
+type WebhookEndpoint struct {
+	ID           uuid.UUID
+	UserID       uuid.UUID
+	Url          string
+	Secret       string
+	Events       []string
+	Enabled      bool
+	FailureCount int32
+	DisabledAt   sql.NullTime
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+type WebhookEvent struct {
+	ID          uuid.UUID
+	Provider    string
+	EventID     string
+	EventType   string
+	Payload     json.RawMessage
+	OccurredAt  sql.NullTime
+	ReceivedAt  time.Time
+	ProcessedAt sql.NullTime
+	Outcome     string
+	Error       sql.NullString
+	Attempts    int32
 }
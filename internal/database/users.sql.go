@@ -7,16 +7,44 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
 )
 
+const bootstrapAdmin = `-- name: BootstrapAdmin :one
+UPDATE users
+SET role = 'admin', sessions_valid_after = date_trunc('second', now() AT TIME ZONE 'UTC'), updated_at = now()
+WHERE users.id = $1 AND NOT EXISTS (SELECT 1 FROM users admins WHERE admins.role = 'admin')
+RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, expand_sensitive, red_expires_at, subscription_event_at, sessions_valid_after, role, email_verified_at
+`
+
+func (q *Queries) BootstrapAdmin(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, bootstrapAdmin, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.ExpandSensitive,
+		&i.RedExpiresAt,
+		&i.SubscriptionEventAt,
+		&i.SessionsValidAfter,
+		&i.Role,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (id, created_at, updated_at, email, hashed_password)
 VALUES (
     gen_random_uuid(), now(), now(), $1, $2
 )
-RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red
+RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, expand_sensitive, red_expires_at, subscription_event_at, sessions_valid_after, role, email_verified_at
 `
 
 type CreateUserParams struct {
@@ -34,6 +62,12 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.UpdatedAt,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.ExpandSensitive,
+		&i.RedExpiresAt,
+		&i.SubscriptionEventAt,
+		&i.SessionsValidAfter,
+		&i.Role,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
@@ -48,7 +82,7 @@ func (q *Queries) DeleteAllUsers(ctx context.Context) error {
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, email, created_at, updated_at, hashed_password, is_chirpy_red FROM users WHERE email = $1
+SELECT id, email, created_at, updated_at, hashed_password, is_chirpy_red, expand_sensitive, red_expires_at, subscription_event_at, sessions_valid_after, role, email_verified_at FROM users WHERE email = $1
 `
 
 func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
@@ -61,12 +95,18 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.UpdatedAt,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.ExpandSensitive,
+		&i.RedExpiresAt,
+		&i.SubscriptionEventAt,
+		&i.SessionsValidAfter,
+		&i.Role,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
 
 const getUserByID = `-- name: GetUserByID :one
-SELECT id, email, created_at, updated_at, hashed_password, is_chirpy_red FROM users WHERE id = $1
+SELECT id, email, created_at, updated_at, hashed_password, is_chirpy_red, expand_sensitive, red_expires_at, subscription_event_at, sessions_valid_after, role, email_verified_at FROM users WHERE id = $1
 `
 
 func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
@@ -79,22 +119,128 @@ func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.UpdatedAt,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.ExpandSensitive,
+		&i.RedExpiresAt,
+		&i.SubscriptionEventAt,
+		&i.SessionsValidAfter,
+		&i.Role,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
 
-const updateUser = `-- name: UpdateUser :one
-UPDATE users SET email = $2, hashed_password = $3, updated_at = now() WHERE id = $1 RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red
+const getUserByIDForUpdate = `-- name: GetUserByIDForUpdate :one
+SELECT id, email, created_at, updated_at, hashed_password, is_chirpy_red, expand_sensitive, red_expires_at, subscription_event_at, sessions_valid_after, role, email_verified_at FROM users WHERE id = $1 FOR UPDATE
 `
 
-type UpdateUserParams struct {
-	ID             uuid.UUID
-	Email          string
-	HashedPassword string
+func (q *Queries) GetUserByIDForUpdate(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByIDForUpdate, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.ExpandSensitive,
+		&i.RedExpiresAt,
+		&i.SubscriptionEventAt,
+		&i.SessionsValidAfter,
+		&i.Role,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
+const getUserSessionsValidAfter = `-- name: GetUserSessionsValidAfter :one
+SELECT sessions_valid_after FROM users WHERE id = $1
+`
+
+func (q *Queries) GetUserSessionsValidAfter(ctx context.Context, id uuid.UUID) (sql.NullTime, error) {
+	row := q.db.QueryRowContext(ctx, getUserSessionsValidAfter, id)
+	var sessions_valid_after sql.NullTime
+	err := row.Scan(&sessions_valid_after)
+	return sessions_valid_after, err
+}
+
+const invalidateUserAccessTokens = `-- name: InvalidateUserAccessTokens :exec
+UPDATE users SET sessions_valid_after = date_trunc('second', now() AT TIME ZONE 'UTC')
+WHERE id = $1
+`
+
+func (q *Queries) InvalidateUserAccessTokens(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, invalidateUserAccessTokens, id)
+	return err
 }
 
-func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, updateUser, arg.ID, arg.Email, arg.HashedPassword)
+const listLapsedSubscriptionsForUpdate = `-- name: ListLapsedSubscriptionsForUpdate :many
+SELECT id, email, created_at, updated_at, hashed_password, is_chirpy_red, expand_sensitive, red_expires_at, subscription_event_at, sessions_valid_after, role, email_verified_at FROM users
+WHERE is_chirpy_red AND red_expires_at IS NOT NULL AND red_expires_at <= (now() AT TIME ZONE 'UTC')
+FOR UPDATE
+`
+
+func (q *Queries) ListLapsedSubscriptionsForUpdate(ctx context.Context) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, listLapsedSubscriptionsForUpdate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Email,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.HashedPassword,
+			&i.IsChirpyRed,
+			&i.ExpandSensitive,
+			&i.RedExpiresAt,
+			&i.SubscriptionEventAt,
+			&i.SessionsValidAfter,
+			&i.Role,
+			&i.EmailVerifiedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockAdminBootstrap = `-- name: LockAdminBootstrap :exec
+SELECT pg_advisory_xact_lock(hashtext('chirpy_admin_bootstrap'))
+`
+
+// Held until the transaction ends so bootstraps run one at a time and each
+// sees whether an earlier one made an admin.
+func (q *Queries) LockAdminBootstrap(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, lockAdminBootstrap)
+	return err
+}
+
+const updateUserEmail = `-- name: UpdateUserEmail :one
+UPDATE users SET email = $2, email_verified_at = now(), updated_at = now()
+WHERE id = $1 AND email = $3
+RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, expand_sensitive, red_expires_at, subscription_event_at, sessions_valid_after, role, email_verified_at
+`
+
+type UpdateUserEmailParams struct {
+	ID       uuid.UUID
+	Email    string
+	OldEmail string
+}
+
+func (q *Queries) UpdateUserEmail(ctx context.Context, arg UpdateUserEmailParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserEmail, arg.ID, arg.Email, arg.OldEmail)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -103,12 +249,18 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.UpdatedAt,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.ExpandSensitive,
+		&i.RedExpiresAt,
+		&i.SubscriptionEventAt,
+		&i.SessionsValidAfter,
+		&i.Role,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
 
 const updateUserIsChirpyRed = `-- name: UpdateUserIsChirpyRed :one
-UPDATE users SET is_chirpy_red = $2, updated_at = now() WHERE id = $1 RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red
+UPDATE users SET is_chirpy_red = $2, updated_at = now() WHERE id = $1 RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, expand_sensitive, red_expires_at, subscription_event_at, sessions_valid_after, role, email_verified_at
 `
 
 type UpdateUserIsChirpyRedParams struct {
@@ -126,6 +278,169 @@ func (q *Queries) UpdateUserIsChirpyRed(ctx context.Context, arg UpdateUserIsChi
 		&i.UpdatedAt,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.ExpandSensitive,
+		&i.RedExpiresAt,
+		&i.SubscriptionEventAt,
+		&i.SessionsValidAfter,
+		&i.Role,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
+const updateUserPassword = `-- name: UpdateUserPassword :one
+UPDATE users SET hashed_password = $2, updated_at = now() WHERE id = $1 RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, expand_sensitive, red_expires_at, subscription_event_at, sessions_valid_after, role, email_verified_at
+`
+
+type UpdateUserPasswordParams struct {
+	ID             uuid.UUID
+	HashedPassword string
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserPassword, arg.ID, arg.HashedPassword)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.ExpandSensitive,
+		&i.RedExpiresAt,
+		&i.SubscriptionEventAt,
+		&i.SessionsValidAfter,
+		&i.Role,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
+const updateUserPreferences = `-- name: UpdateUserPreferences :one
+UPDATE users SET expand_sensitive = $2, updated_at = now() WHERE id = $1 RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, expand_sensitive, red_expires_at, subscription_event_at, sessions_valid_after, role, email_verified_at
+`
+
+type UpdateUserPreferencesParams struct {
+	ID              uuid.UUID
+	ExpandSensitive bool
+}
+
+func (q *Queries) UpdateUserPreferences(ctx context.Context, arg UpdateUserPreferencesParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserPreferences, arg.ID, arg.ExpandSensitive)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.ExpandSensitive,
+		&i.RedExpiresAt,
+		&i.SubscriptionEventAt,
+		&i.SessionsValidAfter,
+		&i.Role,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
+const updateUserRole = `-- name: UpdateUserRole :one
+UPDATE users
+SET role = $2, sessions_valid_after = date_trunc('second', now() AT TIME ZONE 'UTC'), updated_at = now()
+WHERE id = $1
+RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, expand_sensitive, red_expires_at, subscription_event_at, sessions_valid_after, role, email_verified_at
+`
+
+type UpdateUserRoleParams struct {
+	ID   uuid.UUID
+	Role string
+}
+
+func (q *Queries) UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserRole, arg.ID, arg.Role)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.ExpandSensitive,
+		&i.RedExpiresAt,
+		&i.SubscriptionEventAt,
+		&i.SessionsValidAfter,
+		&i.Role,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
+const updateUserSubscription = `-- name: UpdateUserSubscription :one
+UPDATE users SET is_chirpy_red = $2, red_expires_at = $3, subscription_event_at = $4, updated_at = now() WHERE id = $1 RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, expand_sensitive, red_expires_at, subscription_event_at, sessions_valid_after, role, email_verified_at
+`
+
+type UpdateUserSubscriptionParams struct {
+	ID                  uuid.UUID
+	IsChirpyRed         bool
+	RedExpiresAt        sql.NullTime
+	SubscriptionEventAt sql.NullTime
+}
+
+func (q *Queries) UpdateUserSubscription(ctx context.Context, arg UpdateUserSubscriptionParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserSubscription,
+		arg.ID,
+		arg.IsChirpyRed,
+		arg.RedExpiresAt,
+		arg.SubscriptionEventAt,
+	)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.ExpandSensitive,
+		&i.RedExpiresAt,
+		&i.SubscriptionEventAt,
+		&i.SessionsValidAfter,
+		&i.Role,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
+const verifyUserEmail = `-- name: VerifyUserEmail :one
+UPDATE users SET email_verified_at = COALESCE(email_verified_at, now()), updated_at = now()
+WHERE id = $1 AND email = $2
+RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, expand_sensitive, red_expires_at, subscription_event_at, sessions_valid_after, role, email_verified_at
+`
+
+type VerifyUserEmailParams struct {
+	ID    uuid.UUID
+	Email string
+}
+
+func (q *Queries) VerifyUserEmail(ctx context.Context, arg VerifyUserEmailParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, verifyUserEmail, arg.ID, arg.Email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.ExpandSensitive,
+		&i.RedExpiresAt,
+		&i.SubscriptionEventAt,
+		&i.SessionsValidAfter,
+		&i.Role,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
@@ -0,0 +1,135 @@
+package entitlements
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+type Tier string
+
+const (
+	TierFree Tier = "free"
+	TierRed  Tier = "red"
+)
+
+// Limits are the per-tier knobs handlers consult instead of hard-coding
+// numbers. A zero value disables the feature for the tier, except for
+// MaxChirpLength and ChirpsPerHour: posting can't be disabled, so Load
+// requires them to be positive.
+type Limits struct {
+	MaxChirpLength     int      `json:"max_chirp_length"`
+	MaxPinnedChirps    int      `json:"max_pinned_chirps"`
+	MaxScheduledChirps int      `json:"max_scheduled_chirps"`
+	ChirpsPerHour      int      `json:"chirps_per_hour"`
+	MaxMediaBytes      int64    `json:"max_media_bytes"`
+	EditWindow         Duration `json:"edit_window"`
+}
+
+// Config maps every tier to its limits.
+type Config map[Tier]Limits
+
+// Duration is a time.Duration that reads and writes as a Go duration
+// string such as "30m" in JSON.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+func Default() Config {
+	return Config{
+		TierFree: {
+			MaxChirpLength:     140,
+			MaxPinnedChirps:    1,
+			MaxScheduledChirps: 5,
+			ChirpsPerHour:      30,
+			MaxMediaBytes:      5 << 20,
+			EditWindow:         0,
+		},
+		TierRed: {
+			MaxChirpLength:     280,
+			MaxPinnedChirps:    5,
+			MaxScheduledChirps: 50,
+			ChirpsPerHour:      300,
+			MaxMediaBytes:      50 << 20,
+			EditWindow:         Duration(30 * time.Minute),
+		},
+	}
+}
+
+// Load reads tier limits from a JSON file keyed by tier name. Tiers and
+// fields missing from the file keep their default limits, so the file only
+// needs to list what product wants to change.
+func Load(path string) (Config, error) {
+	cfg := Default()
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var overrides map[Tier]json.RawMessage
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("invalid tiers file %s: %w", path, err)
+	}
+
+	for tier, raw := range overrides {
+		limits, ok := cfg[tier]
+		if !ok {
+			return nil, fmt.Errorf("invalid tiers file %s: unknown tier %q", path, tier)
+		}
+		if err := json.Unmarshal(raw, &limits); err != nil {
+			return nil, fmt.Errorf("invalid tiers file %s: %w", path, err)
+		}
+		if err := limits.validate(); err != nil {
+			return nil, fmt.Errorf("invalid tiers file %s: tier %q: %w", path, tier, err)
+		}
+		cfg[tier] = limits
+	}
+
+	return cfg, nil
+}
+
+func (l Limits) validate() error {
+	if l.MaxChirpLength < 1 {
+		return errors.New("max_chirp_length must be positive")
+	}
+	if l.ChirpsPerHour < 1 {
+		return errors.New("chirps_per_hour must be positive")
+	}
+	return nil
+}
+
+// TierFor returns the tier of a user given their Chirpy Red status.
+func TierFor(isChirpyRed bool) Tier {
+	if isChirpyRed {
+		return TierRed
+	}
+	return TierFree
+}
+
+// For returns the limits that apply to a user given their Chirpy Red status.
+func (c Config) For(isChirpyRed bool) Limits {
+	return c[TierFor(isChirpyRed)]
+}
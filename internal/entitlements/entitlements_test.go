@@ -0,0 +1,100 @@
+package entitlements
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	cases := []struct {
+		name        string
+		file        string
+		expectError bool
+		expectFree  int
+		expectRed   int
+	}{
+		{
+			name:       "no file",
+			expectFree: 140,
+			expectRed:  280,
+		},
+		{
+			name:       "override red only",
+			file:       `{"red": {"max_chirp_length": 500, "edit_window": "1h"}}`,
+			expectFree: 140,
+			expectRed:  500,
+		},
+		{
+			name:        "unknown tier",
+			file:        `{"gold": {"max_chirp_length": 500}}`,
+			expectError: true,
+		},
+		{
+			name:        "zero chirp length",
+			file:        `{"free": {"max_chirp_length": 0}}`,
+			expectError: true,
+		},
+		{
+			name:        "zero chirps per hour",
+			file:        `{"red": {"chirps_per_hour": 0}}`,
+			expectError: true,
+		},
+		{
+			name:        "invalid duration",
+			file:        `{"red": {"edit_window": "soon"}}`,
+			expectError: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := ""
+			if tc.file != "" {
+				path = filepath.Join(t.TempDir(), "tiers.json")
+				if err := os.WriteFile(path, []byte(tc.file), 0o600); err != nil {
+					t.Fatalf("failed to write tiers file: %v", err)
+				}
+			}
+
+			cfg, err := Load(path)
+			if tc.expectError {
+				if err == nil {
+					t.Errorf("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := cfg.For(false).MaxChirpLength; got != tc.expectFree {
+				t.Errorf("expected free length %d, got %d", tc.expectFree, got)
+			}
+			if got := cfg.For(true).MaxChirpLength; got != tc.expectRed {
+				t.Errorf("expected red length %d, got %d", tc.expectRed, got)
+			}
+		})
+	}
+}
+
+func TestLoadKeepsDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tiers.json")
+	if err := os.WriteFile(path, []byte(`{"red": {"edit_window": "1h"}}`), 0o600); err != nil {
+		t.Fatalf("failed to write tiers file: %v", err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	red := cfg.For(true)
+	if got := time.Duration(red.EditWindow); got != time.Hour {
+		t.Errorf("expected edit window 1h, got %v", got)
+	}
+	if got, want := red.ChirpsPerHour, Default()[TierRed].ChirpsPerHour; got != want {
+		t.Errorf("expected chirps per hour to keep default %d, got %d", want, got)
+	}
+}
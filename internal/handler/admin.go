@@ -1,10 +1,18 @@
 package handler
 
 import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 
+	"github.com/google/uuid"
+	"github.com/karprabha/chirpy/internal/auth"
 	"github.com/karprabha/chirpy/internal/config"
+	"github.com/karprabha/chirpy/internal/database"
+	"github.com/karprabha/chirpy/internal/policy"
 )
 
 func AdminMetrics(cfg *config.Config) http.HandlerFunc {
@@ -30,9 +38,120 @@ func AdminReset(cfg *config.Config) http.HandlerFunc {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		if err := cfg.Queries.DeleteAllLoginThrottles(r.Context()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		cfg.Revocations.ForgetAll()
 
 		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("Server reset"))
 	})
 }
+
+type roleResponse struct {
+	ID    uuid.UUID `json:"id"`
+	Email string    `json:"email"`
+	Role  string    `json:"role"`
+}
+
+// AdminBootstrap makes the caller the first admin. It needs the
+// ADMIN_BOOTSTRAP_TOKEN and only works while there is no admin, so a leaked
+// token is useless once the deployment has one.
+func AdminBootstrap(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type params struct {
+			BootstrapToken string `json:"bootstrap_token"`
+		}
+
+		var p params
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if cfg.AdminBootstrapToken == "" || subtle.ConstantTimeCompare([]byte(p.BootstrapToken), []byte(cfg.AdminBootstrapToken)) != 1 {
+			http.Error(w, "Forbidden: invalid bootstrap token", http.StatusForbidden)
+			return
+		}
+
+		userID := auth.FromContext(r.Context()).UserID
+
+		tx, err := cfg.DB.BeginTx(r.Context(), nil)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+		qtx := cfg.Queries.WithTx(tx)
+
+		// Without the lock, concurrent bootstraps could each see no admin
+		// and all succeed.
+		if err := qtx.LockAdminBootstrap(r.Context()); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		user, err := qtx.BootstrapAdmin(r.Context(), userID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "An admin already exists", http.StatusConflict)
+			} else {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		cfg.Revocations.ForgetUser(user.ID)
+
+		respond(w, http.StatusOK, roleResponse{ID: user.ID, Email: user.Email, Role: user.Role})
+	}
+}
+
+// AdminUpdateUserRole changes a user's role. The user's access tokens are
+// revoked so the new role applies from their next refresh.
+func AdminUpdateUserRole(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		type params struct {
+			Role string `json:"role"`
+		}
+
+		var p params
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if !policy.ValidRole(p.Role) {
+			http.Error(w, "Unknown role: "+p.Role, http.StatusBadRequest)
+			return
+		}
+
+		user, err := cfg.Queries.UpdateUserRole(r.Context(), database.UpdateUserRoleParams{
+			ID:   id,
+			Role: p.Role,
+		})
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "User not found", http.StatusNotFound)
+			} else {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+		cfg.Revocations.ForgetUser(user.ID)
+
+		respond(w, http.StatusOK, roleResponse{ID: user.ID, Email: user.Email, Role: user.Role})
+	}
+}
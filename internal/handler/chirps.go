@@ -6,13 +6,15 @@ import (
 	"errors"
 	"net/http"
 	"sort"
-	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/karprabha/chirpy/internal/auth"
+	"github.com/karprabha/chirpy/internal/chirptext"
 	"github.com/karprabha/chirpy/internal/config"
 	"github.com/karprabha/chirpy/internal/database"
+	"github.com/karprabha/chirpy/internal/moderation"
+	"github.com/karprabha/chirpy/internal/outbound"
 )
 
 func respond(w http.ResponseWriter, code int, res any) {
@@ -27,71 +29,201 @@ func respond(w http.ResponseWriter, code int, res any) {
 	w.Write(data)
 }
 
+const maxContentWarningLength = 100
+
+type chirpResponse struct {
+	ID             uuid.UUID         `json:"id"`
+	Body           string            `json:"body,omitempty"`
+	UserID         uuid.UUID         `json:"user_id"`
+	ContentWarning string            `json:"content_warning,omitempty"`
+	Sensitive      bool              `json:"sensitive"`
+	Collapsed      bool              `json:"collapsed"`
+	Entities       *entitiesResponse `json:"entities,omitempty"`
+	Poll           *pollResponse     `json:"poll,omitempty"`
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+	Error          string            `json:"error,omitempty"`
+}
+
+// newChirpResponse builds the chirp payload as seen by v. Chirps behind a
+// content warning or flagged as sensitive are collapsed unless the viewer
+// opted into expanding them.
+func newChirpResponse(c database.Chirp, v viewer) chirpResponse {
+	hidden := c.Sensitive || c.ContentWarning.Valid
+
+	return chirpResponse{
+		ID:             c.ID,
+		Body:           c.Body,
+		UserID:         c.UserID,
+		ContentWarning: c.ContentWarning.String,
+		Sensitive:      c.Sensitive,
+		Collapsed:      hidden && !v.ExpandSensitive,
+		CreatedAt:      c.CreatedAt,
+		UpdatedAt:      c.UpdatedAt,
+	}
+}
+
+// viewer is the reader a chirp payload is rendered for. The zero value is an
+// anonymous reader.
+type viewer struct {
+	ID              uuid.UUID
+	ExpandSensitive bool
+}
+
+// loadViewer resolves the reader on routes wrapped in WithOptionalAuth.
+// Anonymous requests and unknown users yield an anonymous viewer rather than
+// an error.
+func loadViewer(cfg *config.Config, r *http.Request) viewer {
+	claims := auth.FromContext(r.Context())
+	if claims == nil {
+		return viewer{}
+	}
+
+	user, err := cfg.Queries.GetUserByID(r.Context(), claims.UserID)
+	if err != nil {
+		return viewer{}
+	}
+
+	return viewer{ID: user.ID, ExpandSensitive: user.ExpandSensitive}
+}
+
 func CreateChirp(cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		token, err := auth.GetBearerToken(r.Header)
-		if err != nil {
-			http.Error(w, "Unauthorized: Invalid or missing token", http.StatusUnauthorized)
+		userID := auth.FromContext(r.Context()).UserID
+
+		type parameters struct {
+			Body           string          `json:"body"`
+			ContentWarning string          `json:"content_warning"`
+			Sensitive      bool            `json:"sensitive"`
+			Poll           *pollParameters `json:"poll"`
+		}
+
+		var params parameters
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
 			return
 		}
 
-		userID, err := auth.ValidateJWT(token, cfg.JWTSecret)
+		author, err := cfg.Queries.GetUserByID(r.Context(), userID)
 		if err != nil {
 			http.Error(w, "Unauthorized: Invalid or expired token", http.StatusUnauthorized)
 			return
 		}
+		if cfg.RequireVerifiedEmail && !author.EmailVerifiedAt.Valid {
+			respond(w, http.StatusForbidden, chirpResponse{Error: "Verify your email address to post chirps"})
+			return
+		}
+		limits := cfg.Tiers.For(author.IsChirpyRed)
 
-		type parameters struct {
-			Body string `json:"body"`
+		body, err := chirptext.Normalize(params.Body)
+		if err != nil {
+			respond(w, http.StatusBadRequest, chirpResponse{Error: err.Error()})
+			return
 		}
-		type response struct {
-			ID        uuid.UUID `json:"id"`
-			Body      string    `json:"body,omitempty"`
-			UserID    uuid.UUID `json:"user_id"`
-			CreatedAt time.Time `json:"created_at"`
-			UpdatedAt time.Time `json:"updated_at"`
-			Error     string    `json:"error,omitempty"`
+		if chirptext.Length(body) > limits.MaxChirpLength {
+			respond(w, http.StatusBadRequest, chirpResponse{Error: "Chirp is too long"})
+			return
+		}
+		contentWarning, err := chirptext.Normalize(params.ContentWarning)
+		if err != nil && !errors.Is(err, chirptext.ErrEmpty) {
+			respond(w, http.StatusBadRequest, chirpResponse{Error: "Invalid content warning"})
+			return
+		}
+		if chirptext.Length(contentWarning) > maxContentWarningLength {
+			respond(w, http.StatusBadRequest, chirpResponse{Error: "Content warning is too long"})
+			return
+		}
+		if params.Poll != nil {
+			if err := params.Poll.validate(time.Now().UTC()); err != nil {
+				respond(w, http.StatusBadRequest, chirpResponse{Error: err.Error()})
+				return
+			}
 		}
 
-		var params parameters
-		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
-			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		tx, err := cfg.DB.BeginTx(r.Context(), nil)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
-		if len(params.Body) > 140 {
-			respond(w, http.StatusBadRequest, response{Error: "Chirp is too long"})
+		defer tx.Rollback()
+		qtx := cfg.Queries.WithTx(tx)
+
+		// Locking the author makes concurrent chirps from the same user
+		// count one at a time, so they can't all get in under the limit.
+		if _, err := qtx.GetUserByIDForUpdate(r.Context(), userID); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 
-		profanity := map[string]bool{
-			"kerfuffle": true, "sharbert": true, "fornax": true,
+		recent, err := qtx.CountChirpsByAuthorInLastHour(r.Context(), userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
 		}
-		words := strings.Fields(params.Body)
-		for i, w := range words {
-			if profanity[strings.ToLower(w)] {
-				words[i] = "****"
-			}
+		if recent >= int64(limits.ChirpsPerHour) {
+			respond(w, http.StatusTooManyRequests, chirpResponse{Error: "Chirp rate limit exceeded"})
+			return
 		}
-		clean := strings.Join(words, " ")
+
+		clean, flagged := moderation.Apply(body, cfg.ModerationMode)
 
 		createChirpParams := database.CreateChirpParams{
 			Body:   clean,
 			UserID: userID,
+			ContentWarning: sql.NullString{
+				String: contentWarning,
+				Valid:  contentWarning != "",
+			},
+			Sensitive: params.Sensitive || flagged,
 		}
 
-		chirp, err := cfg.Queries.CreateChirp(r.Context(), createChirpParams)
+		chirp, err := qtx.CreateChirp(r.Context(), createChirpParams)
 		if err != nil {
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 
-		respond(w, http.StatusCreated, response{
-			ID:        chirp.ID,
-			Body:      chirp.Body,
-			UserID:    chirp.UserID,
-			CreatedAt: chirp.CreatedAt,
-			UpdatedAt: chirp.UpdatedAt,
-		})
+		if err := createLinks(r.Context(), qtx, chirp.ID, chirp.Body); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if params.Poll != nil {
+			if err := createPoll(r.Context(), qtx, chirp.ID, *params.Poll); err != nil {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		v := viewer{ID: author.ID, ExpandSensitive: author.ExpandSensitive}
+
+		polls, err := loadPolls(r.Context(), qtx, []uuid.UUID{chirp.ID}, v.ID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		entities, err := loadEntities(r.Context(), cfg, qtx, []uuid.UUID{chirp.ID})
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		res := newChirpResponse(chirp, v)
+		res.Entities = entities[chirp.ID]
+		res.Poll = polls[chirp.ID]
+
+		if err := outbound.Enqueue(r.Context(), qtx, userID, outbound.EventChirpCreated, res); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		respond(w, http.StatusCreated, res)
 	}
 }
 
@@ -129,24 +261,30 @@ func GetChirps(cfg *config.Config) http.HandlerFunc {
 			})
 		}
 
-		type chirp struct {
-			ID        uuid.UUID `json:"id"`
-			Body      string    `json:"body,omitempty"`
-			UserID    uuid.UUID `json:"user_id"`
-			CreatedAt time.Time `json:"created_at"`
-			UpdatedAt time.Time `json:"updated_at"`
-			Error     string    `json:"error,omitempty"`
+		chirpIDs := make([]uuid.UUID, len(chirps))
+		for i, c := range chirps {
+			chirpIDs[i] = c.ID
+		}
+
+		v := loadViewer(cfg, r)
+
+		polls, err := loadPolls(r.Context(), cfg.Queries, chirpIDs, v.ID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
 		}
 
-		response := make([]chirp, len(chirps))
+		entities, err := loadEntities(r.Context(), cfg, cfg.Queries, chirpIDs)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		response := make([]chirpResponse, len(chirps))
 		for i, c := range chirps {
-			response[i] = chirp{
-				ID:        c.ID,
-				Body:      c.Body,
-				UserID:    c.UserID,
-				CreatedAt: c.CreatedAt,
-				UpdatedAt: c.UpdatedAt,
-			}
+			response[i] = newChirpResponse(c, v)
+			response[i].Entities = entities[c.ID]
+			response[i].Poll = polls[c.ID]
 		}
 
 		respond(w, http.StatusOK, response)
@@ -171,40 +309,31 @@ func GetChirp(cfg *config.Config) http.HandlerFunc {
 			return
 		}
 
-		type response struct {
-			ID        uuid.UUID `json:"id"`
-			Body      string    `json:"body,omitempty"`
-			UserID    uuid.UUID `json:"user_id"`
-			CreatedAt time.Time `json:"created_at"`
-			UpdatedAt time.Time `json:"updated_at"`
-			Error     string    `json:"error,omitempty"`
+		v := loadViewer(cfg, r)
+
+		polls, err := loadPolls(r.Context(), cfg.Queries, []uuid.UUID{chirp.ID}, v.ID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
 		}
 
-		res := response{
-			ID:        chirp.ID,
-			Body:      chirp.Body,
-			UserID:    chirp.UserID,
-			CreatedAt: chirp.CreatedAt,
-			UpdatedAt: chirp.UpdatedAt,
+		entities, err := loadEntities(r.Context(), cfg, cfg.Queries, []uuid.UUID{chirp.ID})
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
 		}
 
+		res := newChirpResponse(chirp, v)
+		res.Entities = entities[chirp.ID]
+		res.Poll = polls[chirp.ID]
+
 		respond(w, http.StatusOK, res)
 	}
 }
 
 func DeleteChirp(cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		token, err := auth.GetBearerToken(r.Header)
-		if err != nil {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
-			return
-		}
-
-		userId, err := auth.ValidateJWT(token, cfg.JWTSecret)
-		if err != nil {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
-			return
-		}
+		userId := auth.FromContext(r.Context()).UserID
 
 		id, err := uuid.Parse(r.PathValue("id"))
 		if err != nil {
@@ -227,12 +356,36 @@ func DeleteChirp(cfg *config.Config) http.HandlerFunc {
 			return
 		}
 
-		err = cfg.Queries.DeleteChirp(r.Context(), id)
+		tx, err := cfg.DB.BeginTx(r.Context(), nil)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+		qtx := cfg.Queries.WithTx(tx)
+
+		err = qtx.DeleteChirp(r.Context(), id)
 		if err != nil {
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 
+		type deletedChirp struct {
+			ID     uuid.UUID `json:"id"`
+			UserID uuid.UUID `json:"user_id"`
+		}
+
+		err = outbound.Enqueue(r.Context(), qtx, userId, outbound.EventChirpDeleted, deletedChirp{ID: chirp.ID, UserID: chirp.UserID})
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
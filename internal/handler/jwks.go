@@ -0,0 +1,16 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/karprabha/chirpy/internal/config"
+)
+
+// JWKS publishes the public keys access tokens are verified with, so other
+// services can verify them without being able to issue them.
+func JWKS(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		respond(w, http.StatusOK, cfg.JWTKeys.JWKS())
+	}
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/karprabha/chirpy/internal/chirptext"
+	"github.com/karprabha/chirpy/internal/config"
+	"github.com/karprabha/chirpy/internal/database"
+)
+
+type linkResponse struct {
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+	URL      string `json:"url"`
+	ShortURL string `json:"short_url"`
+	Clicks   int64  `json:"clicks"`
+}
+
+type entitiesResponse struct {
+	URLs []linkResponse `json:"urls"`
+}
+
+func newLinkResponse(cfg *config.Config, l database.Link) linkResponse {
+	return linkResponse{
+		Start:    int(l.StartIndex),
+		End:      int(l.EndIndex),
+		URL:      l.Url,
+		ShortURL: cfg.BaseURL + "/l/" + l.Code,
+		Clicks:   l.Clicks,
+	}
+}
+
+func createLinks(ctx context.Context, q *database.Queries, chirpID uuid.UUID, body string) error {
+	for _, e := range chirptext.ExtractURLs(body) {
+		code, err := chirptext.MakeShortCode()
+		if err != nil {
+			return err
+		}
+
+		_, err = q.CreateLink(ctx, database.CreateLinkParams{
+			ChirpID:    chirpID,
+			Code:       code,
+			Url:        e.URL,
+			StartIndex: int32(e.Start),
+			EndIndex:   int32(e.End),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadEntities returns the link entities of the given chirps keyed by chirp ID.
+// Chirps without links map to an empty, non-nil entity list.
+func loadEntities(ctx context.Context, cfg *config.Config, q *database.Queries, chirpIDs []uuid.UUID) (map[uuid.UUID]*entitiesResponse, error) {
+	links, err := q.GetLinksByChirpIDs(ctx, chirpIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[uuid.UUID]*entitiesResponse, len(chirpIDs))
+	for _, id := range chirpIDs {
+		res[id] = &entitiesResponse{URLs: []linkResponse{}}
+	}
+	for _, l := range links {
+		res[l.ChirpID].URLs = append(res[l.ChirpID].URLs, newLinkResponse(cfg, l))
+	}
+
+	return res, nil
+}
+
+func FollowLink(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		link, err := cfg.Queries.RecordLinkClick(r.Context(), r.PathValue("code"))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "Link not found", http.StatusNotFound)
+			} else {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		http.Redirect(w, r, chirptext.Href(link.Url), http.StatusFound)
+	}
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/karprabha/chirpy/internal/config"
+	"github.com/karprabha/chirpy/internal/database"
+	"github.com/karprabha/chirpy/internal/loginthrottle"
+)
+
+type loginThrottleResponse struct {
+	Kind              string     `json:"kind"`
+	Subject           string     `json:"subject"`
+	UserID            *uuid.UUID `json:"user_id"`
+	FailureCount      int32      `json:"failure_count"`
+	LastFailedAt      time.Time  `json:"last_failed_at"`
+	Locked            bool       `json:"locked"`
+	LockedUntil       *time.Time `json:"locked_until"`
+	RetryAfterSeconds int        `json:"retry_after_seconds"`
+}
+
+// AdminListLockouts lists the accounts and client IPs with recent failed
+// logins, newest first, and whether they are locked or must wait before
+// trying again. An account is listed by email even if nobody has it.
+func AdminListLockouts(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now().UTC()
+
+		rows, err := cfg.Queries.ListLoginThrottles(r.Context(), loginThrottleCutoff(cfg, now))
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		res := make([]loginThrottleResponse, 0, len(rows))
+		for _, row := range rows {
+			limits := cfg.IPLoginLimits
+			if row.Kind == loginthrottle.KindAccount {
+				limits = cfg.AccountLoginLimits
+			}
+			state := loginthrottle.State{
+				Failures:     int(row.FailureCount),
+				LastFailedAt: row.LastFailedAt,
+				LockedUntil:  row.LockedUntil.Time,
+			}
+
+			item := loginThrottleResponse{
+				Kind:              row.Kind,
+				Subject:           row.Subject,
+				FailureCount:      row.FailureCount,
+				LastFailedAt:      row.LastFailedAt,
+				Locked:            state.Locked(now),
+				RetryAfterSeconds: int(math.Ceil(limits.Wait(state, now).Seconds())),
+			}
+			if row.UserID.Valid {
+				item.UserID = &row.UserID.UUID
+			}
+			if row.LockedUntil.Valid {
+				item.LockedUntil = &row.LockedUntil.Time
+			}
+			res = append(res, item)
+		}
+
+		respond(w, http.StatusOK, res)
+	}
+}
+
+// AdminUnlockUser clears a user's failed logins, ending any lockout.
+func AdminUnlockUser(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		user, err := cfg.Queries.GetUserByID(r.Context(), id)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "User not found", http.StatusNotFound)
+			} else {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		if err := cfg.Queries.DeleteLoginThrottle(r.Context(), database.DeleteLoginThrottleParams{
+			Kind:    loginthrottle.KindAccount,
+			Subject: accountThrottleSubject(user.Email),
+		}); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
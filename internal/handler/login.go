@@ -1,18 +1,40 @@
 package handler
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/karprabha/chirpy/internal/auth"
 	"github.com/karprabha/chirpy/internal/config"
 	"github.com/karprabha/chirpy/internal/database"
+	"github.com/karprabha/chirpy/internal/loginthrottle"
 )
 
+// dummyPasswordHash is checked when no user has the email, so an unknown
+// email takes as long to reject as a wrong password.
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, err := auth.HashPassword("chirpy-dummy-password")
+	if err != nil {
+		panic(err)
+	}
+	return hash
+})
+
+// Login checks an email and password. Failed logins are throttled per
+// account and per client IP: after a few, each one adds a growing delay
+// before the next attempt, and an account that keeps failing is locked until
+// the lockout ends or the password is reset. Accounts are tracked by email,
+// whether or not anyone has it, so throttling doesn't reveal which emails
+// have an account.
 func Login(cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		type params struct {
@@ -31,76 +53,260 @@ func Login(cfg *config.Config) http.HandlerFunc {
 			return
 		}
 
-		user, err := cfg.Queries.GetUserByEmail(r.Context(), p.Email)
+		keys := loginThrottleKeys(cfg, r, p.Email)
+		wait, err := reserveLoginAttempt(r.Context(), cfg, keys, time.Now().UTC())
 		if err != nil {
-			if errors.Is(err, sql.ErrNoRows) {
-				http.Error(w, "Incorrect email or password", http.StatusUnauthorized)
-			} else {
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			}
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if wait > 0 {
+			tooManyLoginAttempts(w, wait)
 			return
 		}
 
-		err = auth.CheckPasswordHash(p.Password, user.HashedPassword)
-		if err != nil {
-			http.Error(w, "Incorrect email or password", http.StatusUnauthorized)
+		user, err := cfg.Queries.GetUserByEmail(r.Context(), p.Email)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 
-		expiration := 1 * time.Hour
+		found := err == nil
+		hashedPassword := dummyPasswordHash()
+		if found {
+			hashedPassword = user.HashedPassword
+		}
+		if auth.CheckPasswordHash(p.Password, hashedPassword) != nil || !found {
+			http.Error(w, "Incorrect email or password", http.StatusUnauthorized)
+			return
+		}
 
-		token, err := auth.MakeJWT(user.ID, cfg.JWTSecret, expiration)
-		if err != nil {
+		mfa, err := cfg.Queries.GetUserTOTP(r.Context(), user.ID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
+		mfaRequired := err == nil && mfa.ConfirmedAt.Valid
 
-		refreshToken, err := auth.MakeRefreshToken()
-		if err != nil {
+		// With 2FA the account's failure stays counted until LoginMFA gets
+		// a correct code, so the password and the code are throttled as one
+		// login.
+		if err := acceptLoginAttempt(r.Context(), cfg.Queries, keys, !mfaRequired); err != nil {
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 
-		createRefreshTokenParams := database.CreateRefreshTokenParams{
-			UserID:    user.ID,
-			Token:     refreshToken,
-			ExpiresAt: time.Now().Add(60 * 24 * time.Hour),
+		if mfaRequired {
+			startMFAChallenge(w, r, cfg, user)
+			return
 		}
 
-		err = cfg.Queries.CreateRefreshToken(r.Context(), createRefreshTokenParams)
+		completeLogin(w, r, cfg, user)
+	}
+}
+
+// loginThrottleKey is something failed logins are counted against.
+type loginThrottleKey struct {
+	kind    string
+	subject string
+	limits  loginthrottle.Limits
+}
+
+func loginThrottleKeys(cfg *config.Config, r *http.Request, email string) []loginThrottleKey {
+	return []loginThrottleKey{
+		{kind: loginthrottle.KindAccount, subject: accountThrottleSubject(email), limits: cfg.AccountLoginLimits},
+		{kind: loginthrottle.KindIP, subject: clientIP(r), limits: cfg.IPLoginLimits},
+	}
+}
+
+// accountThrottleSubject is the subject failed logins to the account with
+// email are counted under.
+func accountThrottleSubject(email string) string {
+	return strings.ToLower(email)
+}
+
+// loginThrottleCutoff is when failures stop counting for every kind of key.
+func loginThrottleCutoff(cfg *config.Config, now time.Time) time.Time {
+	return now.Add(-max(cfg.AccountLoginLimits.Window, cfg.IPLoginLimits.Window,
+		cfg.ResetEmailLimits.Window, cfg.ResetIPLimits.Window))
+}
+
+// reserveLoginAttempt counts a login attempt as failed against every key
+// before the password is checked, so parallel guesses can't all get in
+// before the first failure is recorded. If any key must wait, it returns how
+// long instead and counts nothing.
+func reserveLoginAttempt(ctx context.Context, cfg *config.Config, keys []loginThrottleKey, now time.Time) (time.Duration, error) {
+	if err := cfg.Queries.DeleteStaleLoginThrottles(ctx, loginThrottleCutoff(cfg, now)); err != nil {
+		return 0, err
+	}
+
+	tx, err := cfg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.Queries.WithTx(tx)
+
+	// Keys are always locked in the same order, account first, so
+	// concurrent logins can't deadlock.
+	var wait time.Duration
+	states := make([]loginthrottle.State, len(keys))
+	for i, k := range keys {
+		if err := qtx.EnsureLoginThrottle(ctx, database.EnsureLoginThrottleParams{
+			Kind:         k.kind,
+			Subject:      k.subject,
+			LastFailedAt: now,
+		}); err != nil {
+			return 0, err
+		}
+
+		row, err := qtx.GetLoginThrottleForUpdate(ctx, database.GetLoginThrottleForUpdateParams{
+			Kind:    k.kind,
+			Subject: k.subject,
+		})
 		if err != nil {
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
+			return 0, err
 		}
 
-		type response struct {
-			ID           uuid.UUID `json:"id"`
-			Email        string    `json:"email"`
-			IsChirpyRed  bool      `json:"is_chirpy_red"`
-			CreatedAt    time.Time `json:"created_at"`
-			UpdatedAt    time.Time `json:"updated_at"`
-			Token        string    `json:"token"`
-			RefreshToken string    `json:"refresh_token"`
+		states[i] = loginthrottle.State{
+			Failures:     int(row.FailureCount),
+			LastFailedAt: row.LastFailedAt,
+			LockedUntil:  row.LockedUntil.Time,
 		}
+		wait = max(wait, k.limits.Wait(states[i], now))
+	}
+	if wait > 0 {
+		return wait, nil
+	}
 
-		res := response{
-			ID:           user.ID,
-			Email:        user.Email,
-			IsChirpyRed:  user.IsChirpyRed,
-			CreatedAt:    user.CreatedAt,
-			UpdatedAt:    user.UpdatedAt,
-			Token:        token,
-			RefreshToken: refreshToken,
+	for i, k := range keys {
+		s := k.limits.Fail(states[i], now)
+		if err := qtx.UpdateLoginThrottle(ctx, database.UpdateLoginThrottleParams{
+			Kind:         k.kind,
+			Subject:      k.subject,
+			FailureCount: int32(s.Failures),
+			LastFailedAt: s.LastFailedAt,
+			LockedUntil:  sql.NullTime{Time: s.LockedUntil, Valid: !s.LockedUntil.IsZero()},
+		}); err != nil {
+			return 0, err
 		}
+	}
+
+	return 0, tx.Commit()
+}
 
-		data, err := json.Marshal(res)
+// reserveReauthAttempt reserves an attempt for a signed-in user who is
+// confirming a change with their password or a code. It counts like a login,
+// so a stolen access token can't be used to guess them faster. If the
+// attempt must wait, it responds and returns false. A correct password or
+// code should be passed to acceptLoginAttempt with the keys.
+func reserveReauthAttempt(w http.ResponseWriter, r *http.Request, cfg *config.Config, email string) ([]loginThrottleKey, bool) {
+	keys := loginThrottleKeys(cfg, r, email)
+	wait, err := reserveLoginAttempt(r.Context(), cfg, keys, time.Now().UTC())
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return nil, false
+	}
+	if wait > 0 {
+		tooManyLoginAttempts(w, wait)
+		return nil, false
+	}
+	return keys, true
+}
+
+// tooManyLoginAttempts responds to an attempt that came before the keys'
+// wait was over.
+func tooManyLoginAttempts(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, "Too many failed login attempts, try again later", http.StatusTooManyRequests)
+}
+
+// acceptLoginAttempt takes back the failure reserved for a correct password
+// or code. The IP only gets this attempt back, so logging in to one account
+// doesn't hide guesses at others. The account's failures are cleared if
+// loggedIn, and otherwise stay counted until the rest of the login succeeds.
+func acceptLoginAttempt(ctx context.Context, q *database.Queries, keys []loginThrottleKey, loggedIn bool) error {
+	for _, k := range keys {
+		var err error
+		if k.kind == loginthrottle.KindAccount {
+			if !loggedIn {
+				continue
+			}
+			err = q.DeleteLoginThrottle(ctx, database.DeleteLoginThrottleParams{Kind: k.kind, Subject: k.subject})
+		} else {
+			err = q.ForgiveLoginFailure(ctx, database.ForgiveLoginFailureParams{Kind: k.kind, Subject: k.subject})
+		}
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			return err
 		}
+	}
+	return nil
+}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		w.Write(data)
+// completeLogin starts a session for a user who has proven who they are and
+// responds with the user and their tokens.
+func completeLogin(w http.ResponseWriter, r *http.Request, cfg *config.Config, user database.User) {
+	tx, err := cfg.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
 	}
+	defer tx.Rollback()
+	qtx := cfg.Queries.WithTx(tx)
+
+	session, err := startSession(r.Context(), qtx, user.ID, r)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	refreshToken, err := issueRefreshToken(r.Context(), qtx, user.ID, session.ID)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	token, err := issueAccessToken(cfg, user, session.ID)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	type response struct {
+		ID            uuid.UUID `json:"id"`
+		Email         string    `json:"email"`
+		EmailVerified bool      `json:"email_verified"`
+		IsChirpyRed   bool      `json:"is_chirpy_red"`
+		Role          string    `json:"role"`
+		CreatedAt     time.Time `json:"created_at"`
+		UpdatedAt     time.Time `json:"updated_at"`
+		Token         string    `json:"token"`
+		RefreshToken  string    `json:"refresh_token"`
+	}
+
+	res := response{
+		ID:            user.ID,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		IsChirpyRed:   user.IsChirpyRed,
+		Role:          user.Role,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Token:         token,
+		RefreshToken:  refreshToken,
+	}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
 }
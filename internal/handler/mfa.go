@@ -0,0 +1,460 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/karprabha/chirpy/internal/auth"
+	"github.com/karprabha/chirpy/internal/config"
+	"github.com/karprabha/chirpy/internal/database"
+	"github.com/karprabha/chirpy/internal/totp"
+)
+
+const (
+	totpIssuer        = "Chirpy"
+	recoveryCodeCount = 10
+
+	// An MFA challenge must be answered within mfaChallengeTTL and allows
+	// maxMFAAttempts guesses, so codes can't be brute forced with it.
+	mfaChallengeTTL = 5 * time.Minute
+	maxMFAAttempts  = 5
+)
+
+// secondFactor is a TOTP code or a recovery code, whichever the user sent.
+type secondFactor struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// verifySecondFactor checks f against the user's confirmed TOTP secret or
+// unused recovery codes. A TOTP code is accepted once; a recovery code is
+// used up.
+func verifySecondFactor(ctx context.Context, q *database.Queries, secret database.UserTotp, f secondFactor) (bool, error) {
+	if f.Code != "" {
+		step, ok := totp.Verify(secret.Secret, f.Code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		n, err := q.UseTOTPStep(ctx, database.UseTOTPStepParams{
+			UserID:       secret.UserID,
+			LastUsedStep: sql.NullInt64{Int64: step, Valid: true},
+		})
+		return n > 0, err
+	}
+
+	if f.RecoveryCode != "" {
+		n, err := q.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+			UserID:   secret.UserID,
+			CodeHash: auth.HashRecoveryCode(f.RecoveryCode),
+		})
+		return n > 0, err
+	}
+
+	return false, nil
+}
+
+// startMFAChallenge responds to a correct password from a user with 2FA
+// enabled. No session is started until the challenge is answered with
+// LoginMFA.
+func startMFAChallenge(w http.ResponseWriter, r *http.Request, cfg *config.Config, user database.User) {
+	token, err := auth.MakeMFAToken()
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Challenges are only useful for minutes, so this is a good time to drop
+	// old ones.
+	if err := cfg.Queries.DeleteExpiredMFAChallenges(r.Context()); err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	expiresAt := time.Now().UTC().Add(mfaChallengeTTL)
+	err = cfg.Queries.CreateMFAChallenge(r.Context(), database.CreateMFAChallengeParams{
+		TokenHash: auth.HashRefreshToken(token),
+		UserID:    user.ID,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	type response struct {
+		MFARequired bool      `json:"mfa_required"`
+		MFAToken    string    `json:"mfa_token"`
+		ExpiresAt   time.Time `json:"expires_at"`
+	}
+
+	respond(w, http.StatusOK, response{
+		MFARequired: true,
+		MFAToken:    token,
+		ExpiresAt:   expiresAt,
+	})
+}
+
+// LoginMFA completes a login by answering the challenge issued for a correct
+// password with a TOTP code or a recovery code. Wrong codes are throttled
+// together with wrong passwords for the account, and the account's failures
+// are only cleared once the code is right.
+func LoginMFA(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type params struct {
+			MFAToken string `json:"mfa_token"`
+			secondFactor
+		}
+
+		var p params
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if p.MFAToken == "" || (p.Code == "") == (p.RecoveryCode == "") {
+			http.Error(w, "mfa_token and one of code or recovery_code are required", http.StatusBadRequest)
+			return
+		}
+
+		tx, err := cfg.DB.BeginTx(r.Context(), nil)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+		qtx := cfg.Queries.WithTx(tx)
+
+		challenge, err := qtx.GetMFAChallengeForUpdate(r.Context(), auth.HashRefreshToken(p.MFAToken))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "Invalid or expired MFA token", http.StatusUnauthorized)
+			} else {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		if challenge.UsedAt.Valid || challenge.ExpiresAt.Before(time.Now().UTC()) || challenge.Attempts >= maxMFAAttempts {
+			http.Error(w, "Invalid or expired MFA token", http.StatusUnauthorized)
+			return
+		}
+
+		user, err := qtx.GetUserByID(r.Context(), challenge.UserID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		// Wrong codes count against the account like wrong passwords, so
+		// opening new challenges doesn't give more guesses.
+		keys := loginThrottleKeys(cfg, r, user.Email)
+		wait, err := reserveLoginAttempt(r.Context(), cfg, keys, time.Now().UTC())
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if wait > 0 {
+			tooManyLoginAttempts(w, wait)
+			return
+		}
+
+		if err := qtx.RecordMFAChallengeAttempt(r.Context(), challenge.TokenHash); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		secret, err := qtx.GetUserTOTP(r.Context(), challenge.UserID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		ok := false
+		if err == nil && secret.ConfirmedAt.Valid {
+			ok, err = verifySecondFactor(r.Context(), qtx, secret, p.secondFactor)
+			if err != nil {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if ok {
+			if err := qtx.UseMFAChallenge(r.Context(), challenge.TokenHash); err != nil {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		// Commit either way so failed attempts count.
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if !ok {
+			http.Error(w, "Invalid code", http.StatusUnauthorized)
+			return
+		}
+
+		if err := acceptLoginAttempt(r.Context(), cfg.Queries, keys, true); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		completeLogin(w, r, cfg, user)
+	}
+}
+
+// EnrollTOTP starts setting up 2FA by generating a secret for the caller's
+// authenticator app. 2FA is enabled once ConfirmTOTP receives a code for it.
+// Enrolling again before confirming replaces the secret.
+func EnrollTOTP(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.FromContext(r.Context()).UserID
+
+		user, err := cfg.Queries.GetUserByID(r.Context(), userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		secret, err := totp.NewSecret()
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		_, err = cfg.Queries.StartTOTPEnrollment(r.Context(), database.StartTOTPEnrollmentParams{
+			UserID: userID,
+			Secret: secret,
+		})
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+			} else {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		type response struct {
+			Secret string `json:"secret"`
+			URI    string `json:"uri"`
+		}
+
+		respond(w, http.StatusOK, response{
+			Secret: secret,
+			URI:    totp.URI(totpIssuer, user.Email, secret),
+		})
+	}
+}
+
+// ConfirmTOTP enables 2FA once the caller proves their authenticator app has
+// the secret, and returns a fresh set of recovery codes. The codes are only
+// ever shown here.
+func ConfirmTOTP(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.FromContext(r.Context()).UserID
+
+		type params struct {
+			Code string `json:"code"`
+		}
+
+		var p params
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		secret, err := cfg.Queries.GetUserTOTP(r.Context(), userID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "Two-factor authentication enrollment not started", http.StatusNotFound)
+			} else {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+		if secret.ConfirmedAt.Valid {
+			http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+			return
+		}
+
+		step, ok := totp.Verify(secret.Secret, p.Code, time.Now())
+		if !ok {
+			http.Error(w, "Invalid code", http.StatusBadRequest)
+			return
+		}
+
+		codes, err := auth.MakeRecoveryCodes(recoveryCodeCount)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		tx, err := cfg.DB.BeginTx(r.Context(), nil)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+		qtx := cfg.Queries.WithTx(tx)
+
+		n, err := qtx.ConfirmTOTP(r.Context(), database.ConfirmTOTPParams{
+			UserID:       userID,
+			LastUsedStep: sql.NullInt64{Int64: step, Valid: true},
+		})
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if n == 0 {
+			http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+			return
+		}
+
+		if err := replaceRecoveryCodes(r.Context(), qtx, userID, codes); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		type response struct {
+			RecoveryCodes []string `json:"recovery_codes"`
+		}
+
+		respond(w, http.StatusOK, response{RecoveryCodes: codes})
+	}
+}
+
+func replaceRecoveryCodes(ctx context.Context, q *database.Queries, userID uuid.UUID, codes []string) error {
+	if err := q.DeleteRecoveryCodes(ctx, userID); err != nil {
+		return err
+	}
+	for _, code := range codes {
+		err := q.CreateRecoveryCode(ctx, database.CreateRecoveryCodeParams{
+			UserID:   userID,
+			CodeHash: auth.HashRecoveryCode(code),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetTOTPStatus reports whether 2FA is enabled and how many recovery codes
+// are left.
+func GetTOTPStatus(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.FromContext(r.Context()).UserID
+
+		type response struct {
+			Enabled       bool       `json:"enabled"`
+			EnabledAt     *time.Time `json:"enabled_at"`
+			RecoveryCodes int64      `json:"recovery_codes_remaining"`
+		}
+
+		var res response
+
+		secret, err := cfg.Queries.GetUserTOTP(r.Context(), userID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if err == nil && secret.ConfirmedAt.Valid {
+			res.Enabled = true
+			res.EnabledAt = &secret.ConfirmedAt.Time
+
+			res.RecoveryCodes, err = cfg.Queries.CountUnusedRecoveryCodes(r.Context(), userID)
+			if err != nil {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		respond(w, http.StatusOK, res)
+	}
+}
+
+// DisableTOTP turns 2FA off. It takes a current code or a recovery code, so
+// a stolen access token alone can't remove the second factor.
+func DisableTOTP(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.FromContext(r.Context()).UserID
+
+		var p secondFactor
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		user, err := cfg.Queries.GetUserByID(r.Context(), userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		keys, ok := reserveReauthAttempt(w, r, cfg, user.Email)
+		if !ok {
+			return
+		}
+
+		tx, err := cfg.DB.BeginTx(r.Context(), nil)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+		qtx := cfg.Queries.WithTx(tx)
+
+		secret, err := qtx.GetUserTOTP(r.Context(), userID)
+		if err != nil || !secret.ConfirmedAt.Valid {
+			if err == nil || errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "Two-factor authentication is not enabled", http.StatusNotFound)
+			} else {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		ok, err = verifySecondFactor(r.Context(), qtx, secret, p)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "Invalid code", http.StatusBadRequest)
+			return
+		}
+
+		if err := acceptLoginAttempt(r.Context(), qtx, keys, true); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if err := qtx.DeleteUserTOTP(r.Context(), userID); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if err := qtx.DeleteRecoveryCodes(r.Context(), userID); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
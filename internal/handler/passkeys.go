@@ -0,0 +1,324 @@
+package handler
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/karprabha/chirpy/internal/auth"
+	"github.com/karprabha/chirpy/internal/config"
+	"github.com/karprabha/chirpy/internal/database"
+	"github.com/karprabha/chirpy/internal/webauthn"
+)
+
+const (
+	ceremonyRegistration   = "registration"
+	ceremonyAuthentication = "authentication"
+
+	maxPasskeyNameLength = 64
+)
+
+type passkeyResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+func newPasskeyResponse(c database.WebauthnCredential) passkeyResponse {
+	res := passkeyResponse{ID: c.ID, Name: c.Name, CreatedAt: c.CreatedAt}
+	if c.LastUsedAt.Valid {
+		res.LastUsedAt = &c.LastUsedAt.Time
+	}
+	return res
+}
+
+// startCeremony stores a new challenge for a registration or login. userID
+// is uuid.Nil for logins.
+func startCeremony(r *http.Request, cfg *config.Config, ceremony string, userID uuid.UUID) (database.WebauthnChallenge, error) {
+	if err := cfg.Queries.DeleteExpiredWebAuthnChallenges(r.Context()); err != nil {
+		return database.WebauthnChallenge{}, err
+	}
+
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return database.WebauthnChallenge{}, err
+	}
+
+	return cfg.Queries.CreateWebAuthnChallenge(r.Context(), database.CreateWebAuthnChallengeParams{
+		UserID:    uuid.NullUUID{UUID: userID, Valid: userID != uuid.Nil},
+		Ceremony:  ceremony,
+		Challenge: challenge,
+		ExpiresAt: time.Now().UTC().Add(webauthn.Timeout),
+	})
+}
+
+// consumeCeremony removes the challenge so it can be answered only once, and
+// returns it if it is still valid.
+func consumeCeremony(r *http.Request, cfg *config.Config, ceremony string, id uuid.UUID) (database.WebauthnChallenge, bool, error) {
+	c, err := cfg.Queries.ConsumeWebAuthnChallenge(r.Context(), database.ConsumeWebAuthnChallengeParams{
+		ID:       id,
+		Ceremony: ceremony,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return c, false, nil
+	}
+	if err != nil {
+		return c, false, err
+	}
+	return c, c.ExpiresAt.After(time.Now().UTC()), nil
+}
+
+// PasskeyRegistrationOptions starts registering a passkey for the caller and
+// returns the options to pass to navigator.credentials.create.
+func PasskeyRegistrationOptions(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.FromContext(r.Context()).UserID
+
+		user, err := cfg.Queries.GetUserByID(r.Context(), userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		existing, err := cfg.Queries.GetWebAuthnCredentialsByUserID(r.Context(), userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		exclude := make([][]byte, len(existing))
+		for i, c := range existing {
+			exclude[i] = c.CredentialID
+		}
+
+		challenge, err := startCeremony(r, cfg, ceremonyRegistration, userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		type response struct {
+			ChallengeID uuid.UUID                `json:"challenge_id"`
+			PublicKey   webauthn.CreationOptions `json:"public_key"`
+		}
+
+		webauthnUser := webauthn.User{ID: user.ID[:], Name: user.Email, DisplayName: user.Email}
+		respond(w, http.StatusOK, response{
+			ChallengeID: challenge.ID,
+			PublicKey:   cfg.WebAuthn.CreationOptions(webauthnUser, challenge.Challenge, exclude),
+		})
+	}
+}
+
+// RegisterPasskey finishes registering a passkey with the authenticator's
+// response to the options from PasskeyRegistrationOptions.
+func RegisterPasskey(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.FromContext(r.Context()).UserID
+
+		type params struct {
+			ChallengeID uuid.UUID                     `json:"challenge_id"`
+			Name        string                        `json:"name"`
+			Credential  webauthn.RegistrationResponse `json:"credential"`
+		}
+
+		var p params
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if p.Name == "" {
+			p.Name = "Passkey"
+		}
+		if len(p.Name) > maxPasskeyNameLength {
+			http.Error(w, "Passkey name is too long", http.StatusBadRequest)
+			return
+		}
+
+		challenge, ok, err := consumeCeremony(r, cfg, ceremonyRegistration, p.ChallengeID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !ok || challenge.UserID.UUID != userID {
+			http.Error(w, "Invalid or expired challenge", http.StatusBadRequest)
+			return
+		}
+
+		cred, err := cfg.WebAuthn.VerifyRegistration(challenge.Challenge, &p.Credential)
+		if err != nil {
+			http.Error(w, "Passkey registration failed: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		created, err := cfg.Queries.CreateWebAuthnCredential(r.Context(), database.CreateWebAuthnCredentialParams{
+			UserID:       userID,
+			CredentialID: cred.ID,
+			PublicKey:    cred.PublicKey,
+			SignCount:    int64(cred.SignCount),
+			Name:         p.Name,
+		})
+		if err != nil {
+			if isUniqueViolation(err) {
+				http.Error(w, "Passkey is already registered", http.StatusConflict)
+			} else {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		respond(w, http.StatusCreated, newPasskeyResponse(created))
+	}
+}
+
+func GetPasskeys(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.FromContext(r.Context()).UserID
+
+		creds, err := cfg.Queries.GetWebAuthnCredentialsByUserID(r.Context(), userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		res := make([]passkeyResponse, len(creds))
+		for i, c := range creds {
+			res[i] = newPasskeyResponse(c)
+		}
+
+		respond(w, http.StatusOK, res)
+	}
+}
+
+func DeletePasskey(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.FromContext(r.Context()).UserID
+
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid passkey ID", http.StatusBadRequest)
+			return
+		}
+
+		n, err := cfg.Queries.DeleteWebAuthnCredential(r.Context(), database.DeleteWebAuthnCredentialParams{
+			ID:     id,
+			UserID: userID,
+		})
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if n == 0 {
+			http.Error(w, "Passkey not found", http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// PasskeyLoginOptions starts a passkey login and returns the options to pass
+// to navigator.credentials.get. No email is needed: the authenticator offers
+// the passkeys it holds for the site and says which user was picked.
+func PasskeyLoginOptions(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		challenge, err := startCeremony(r, cfg, ceremonyAuthentication, uuid.Nil)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		type response struct {
+			ChallengeID uuid.UUID               `json:"challenge_id"`
+			PublicKey   webauthn.RequestOptions `json:"public_key"`
+		}
+
+		respond(w, http.StatusOK, response{
+			ChallengeID: challenge.ID,
+			PublicKey:   cfg.WebAuthn.RequestOptions(challenge.Challenge, nil),
+		})
+	}
+}
+
+// LoginPasskey logs in with the authenticator's response to the options from
+// PasskeyLoginOptions. Passkeys require user verification, so this is a full
+// login even for users with two-factor authentication.
+func LoginPasskey(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type params struct {
+			ChallengeID uuid.UUID                  `json:"challenge_id"`
+			Credential  webauthn.AssertionResponse `json:"credential"`
+		}
+
+		var p params
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		challenge, ok, err := consumeCeremony(r, cfg, ceremonyAuthentication, p.ChallengeID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "Invalid or expired challenge", http.StatusUnauthorized)
+			return
+		}
+
+		stored, err := cfg.Queries.GetWebAuthnCredentialByCredentialID(r.Context(), p.Credential.RawID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "Unknown passkey", http.StatusUnauthorized)
+			} else {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		// The user handle is the user ID the passkey was created for.
+		if handle := p.Credential.Response.UserHandle; len(handle) != 0 && !bytes.Equal(handle, stored.UserID[:]) {
+			http.Error(w, "Unknown passkey", http.StatusUnauthorized)
+			return
+		}
+
+		signCount, err := cfg.WebAuthn.VerifyAssertion(challenge.Challenge, &webauthn.Credential{
+			ID:        stored.CredentialID,
+			PublicKey: stored.PublicKey,
+			SignCount: uint32(stored.SignCount),
+		}, &p.Credential)
+		if err != nil {
+			http.Error(w, "Passkey login failed", http.StatusUnauthorized)
+			return
+		}
+
+		// Compare-and-set on the old counter, so two logins racing with the
+		// same counter value can't both succeed.
+		n, err := cfg.Queries.UseWebAuthnCredential(r.Context(), database.UseWebAuthnCredentialParams{
+			ID:          stored.ID,
+			SignCount:   int64(signCount),
+			SignCount_2: stored.SignCount,
+		})
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if n == 0 {
+			http.Error(w, "Passkey login failed", http.StatusUnauthorized)
+			return
+		}
+
+		user, err := cfg.Queries.GetUserByID(r.Context(), stored.UserID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		completeLogin(w, r, cfg, user)
+	}
+}
@@ -0,0 +1,222 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/karprabha/chirpy/internal/auth"
+	"github.com/karprabha/chirpy/internal/config"
+	"github.com/karprabha/chirpy/internal/database"
+	"github.com/karprabha/chirpy/internal/loginthrottle"
+	"github.com/karprabha/chirpy/internal/mailer"
+)
+
+const (
+	passwordResetTTL = time.Hour
+
+	// passwordResetResendInterval is how soon after a reset link another
+	// one can be sent while the first is still unused.
+	passwordResetResendInterval = 5 * time.Minute
+
+	// forgotPasswordTimeout bounds the work done after ForgotPassword has
+	// responded.
+	forgotPasswordTimeout = 30 * time.Second
+)
+
+// ForgotPassword emails a password reset link to the address, if it belongs
+// to a user. It always responds 202 Accepted before doing any work, so the
+// response and its timing don't reveal whether the address has an account.
+// Requests are throttled per email and per client IP whether or not the
+// email has an account, and no new link is sent while one sent in the last
+// few minutes is unused.
+func ForgotPassword(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type params struct {
+			Email string `json:"email"`
+		}
+
+		var p params
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if p.Email == "" {
+			http.Error(w, "email is required", http.StatusBadRequest)
+			return
+		}
+
+		keys := []loginThrottleKey{
+			{kind: loginthrottle.KindResetEmail, subject: accountThrottleSubject(p.Email), limits: cfg.ResetEmailLimits},
+			{kind: loginthrottle.KindResetIP, subject: clientIP(r), limits: cfg.ResetIPLimits},
+		}
+		wait, err := reserveLoginAttempt(r.Context(), cfg, keys, time.Now().UTC())
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "Too many password reset requests, try again later", http.StatusTooManyRequests)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), forgotPasswordTimeout)
+		go func() {
+			defer cancel()
+			if err := sendPasswordResetEmail(ctx, cfg, p.Email); err != nil {
+				log.Printf("Failed to send password reset email: %v", err)
+			}
+		}()
+	}
+}
+
+func sendPasswordResetEmail(ctx context.Context, cfg *config.Config, email string) error {
+	user, err := cfg.Queries.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := cfg.Queries.DeleteExpiredPasswordResetTokens(ctx); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	recent, err := cfg.Queries.HasPasswordResetTokenExpiringAfter(ctx, database.HasPasswordResetTokenExpiringAfterParams{
+		UserID:    user.ID,
+		ExpiresAt: now.Add(passwordResetTTL - passwordResetResendInterval),
+	})
+	if err != nil {
+		return err
+	}
+	if recent {
+		return nil
+	}
+
+	token, err := auth.MakePasswordResetToken()
+	if err != nil {
+		return err
+	}
+
+	err = cfg.Queries.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashRefreshToken(token),
+		UserID:    user.ID,
+		ExpiresAt: now.Add(passwordResetTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	return cfg.Mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password for your Chirpy account. "+
+			"To choose a new password, open the link below:\n\n%s\n\n"+
+			"The link works once and expires in 1 hour. If you didn't ask for this, you can ignore this email.\n",
+			appLink(cfg, "reset-password", token)),
+	})
+}
+
+// ResetPassword sets a new password with a token from the reset email. Every
+// session of the user is logged out and every access token revoked, any
+// other reset links stop working, and a login lockout on the account ends.
+func ResetPassword(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type params struct {
+			Token    string `json:"token"`
+			Password string `json:"password"`
+		}
+
+		var p params
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if p.Token == "" || p.Password == "" {
+			http.Error(w, "token and password are required", http.StatusBadRequest)
+			return
+		}
+
+		tx, err := cfg.DB.BeginTx(r.Context(), nil)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+		qtx := cfg.Queries.WithTx(tx)
+
+		token, err := qtx.GetPasswordResetTokenForUpdate(r.Context(), auth.HashRefreshToken(p.Token))
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if err != nil || token.UsedAt.Valid || token.ExpiresAt.Before(time.Now().UTC()) {
+			http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+			return
+		}
+
+		// The token stays unused if the password is refused, so the user
+		// can try another one with the same link.
+		user, err := qtx.GetUserByID(r.Context(), token.UserID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !checkPassword(w, r, cfg, p.Password, user.Email) {
+			return
+		}
+
+		hashedPassword, err := auth.HashPassword(p.Password)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if _, err := qtx.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+			ID:             token.UserID,
+			HashedPassword: hashedPassword,
+		}); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		ended, err := logOutAfterPasswordChange(r.Context(), qtx, token.UserID, uuid.Nil)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		// Proving control of the email ends a lockout from failed logins.
+		if err := qtx.DeleteLoginThrottle(r.Context(), database.DeleteLoginThrottleParams{
+			Kind:    loginthrottle.KindAccount,
+			Subject: accountThrottleSubject(user.Email),
+		}); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		cfg.Revocations.ForgetUser(token.UserID)
+		forgetSessions(cfg, ended...)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
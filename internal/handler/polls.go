@@ -0,0 +1,266 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/karprabha/chirpy/internal/auth"
+	"github.com/karprabha/chirpy/internal/chirptext"
+	"github.com/karprabha/chirpy/internal/config"
+	"github.com/karprabha/chirpy/internal/database"
+)
+
+const (
+	minPollOptions      = 2
+	maxPollOptions      = 4
+	maxPollOptionLength = 25
+	minPollDuration     = 5 * time.Minute
+	maxPollDuration     = 7 * 24 * time.Hour
+)
+
+type pollParameters struct {
+	Options   []string  `json:"options"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type pollOptionResponse struct {
+	ID    uuid.UUID `json:"id"`
+	Text  string    `json:"text"`
+	Votes *int64    `json:"votes,omitempty"`
+}
+
+type pollResponse struct {
+	ID            uuid.UUID            `json:"id"`
+	Options       []pollOptionResponse `json:"options"`
+	ExpiresAt     time.Time            `json:"expires_at"`
+	Closed        bool                 `json:"closed"`
+	TotalVotes    *int64               `json:"total_votes,omitempty"`
+	VotedOptionID *uuid.UUID           `json:"voted_option_id,omitempty"`
+}
+
+// validate trims the options in place and checks them against the poll limits.
+func (p *pollParameters) validate(now time.Time) error {
+	if len(p.Options) < minPollOptions || len(p.Options) > maxPollOptions {
+		return errors.New("Poll must have between 2 and 4 options")
+	}
+
+	seen := make(map[string]bool, len(p.Options))
+	for i, option := range p.Options {
+		option, err := chirptext.Normalize(option)
+		if errors.Is(err, chirptext.ErrEmpty) {
+			return errors.New("Poll options must not be empty")
+		}
+		if err != nil {
+			return errors.New("Poll option contains invalid characters")
+		}
+		if chirptext.Length(option) > maxPollOptionLength {
+			return errors.New("Poll option is too long")
+		}
+		if seen[strings.ToLower(option)] {
+			return errors.New("Poll options must be unique")
+		}
+		seen[strings.ToLower(option)] = true
+		p.Options[i] = option
+	}
+
+	if p.ExpiresAt.Before(now.Add(minPollDuration)) {
+		return errors.New("Poll must stay open for at least 5 minutes")
+	}
+	if p.ExpiresAt.After(now.Add(maxPollDuration)) {
+		return errors.New("Poll can stay open for at most 7 days")
+	}
+
+	return nil
+}
+
+func createPoll(ctx context.Context, q *database.Queries, chirpID uuid.UUID, p pollParameters) error {
+	poll, err := q.CreatePoll(ctx, database.CreatePollParams{
+		ChirpID:   chirpID,
+		ExpiresAt: p.ExpiresAt.UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, option := range p.Options {
+		_, err := q.CreatePollOption(ctx, database.CreatePollOptionParams{
+			PollID:   poll.ID,
+			Position: int32(i),
+			Text:     option,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadPolls returns the polls attached to the given chirps keyed by chirp ID.
+// Tallies are only included once the viewer has voted or the poll has closed.
+func loadPolls(ctx context.Context, q *database.Queries, chirpIDs []uuid.UUID, viewerID uuid.UUID) (map[uuid.UUID]*pollResponse, error) {
+	polls, err := q.GetPollsByChirpIDs(ctx, chirpIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(polls) == 0 {
+		return map[uuid.UUID]*pollResponse{}, nil
+	}
+
+	pollIDs := make([]uuid.UUID, len(polls))
+	for i, p := range polls {
+		pollIDs[i] = p.ID
+	}
+
+	options, err := q.GetPollOptionsByPollIDs(ctx, pollIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	counts, err := q.CountPollVotesByPollIDs(ctx, pollIDs)
+	if err != nil {
+		return nil, err
+	}
+	votesByOption := make(map[uuid.UUID]int64, len(counts))
+	for _, c := range counts {
+		votesByOption[c.OptionID] = c.Votes
+	}
+
+	votedOption := map[uuid.UUID]uuid.UUID{}
+	if viewerID != uuid.Nil {
+		votes, err := q.GetPollVotesByUser(ctx, database.GetPollVotesByUserParams{
+			UserID:  viewerID,
+			PollIds: pollIDs,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range votes {
+			votedOption[v.PollID] = v.OptionID
+		}
+	}
+
+	optionsByPoll := map[uuid.UUID][]database.PollOption{}
+	for _, o := range options {
+		optionsByPoll[o.PollID] = append(optionsByPoll[o.PollID], o)
+	}
+
+	now := time.Now().UTC()
+	res := make(map[uuid.UUID]*pollResponse, len(polls))
+	for _, p := range polls {
+		pr := &pollResponse{
+			ID:        p.ID,
+			ExpiresAt: p.ExpiresAt,
+			Closed:    !p.ExpiresAt.After(now),
+		}
+
+		optionID, voted := votedOption[p.ID]
+		if voted {
+			pr.VotedOptionID = &optionID
+		}
+		showResults := voted || pr.Closed
+
+		var total int64
+		for _, o := range optionsByPoll[p.ID] {
+			or := pollOptionResponse{ID: o.ID, Text: o.Text}
+			if showResults {
+				votes := votesByOption[o.ID]
+				or.Votes = &votes
+				total += votes
+			}
+			pr.Options = append(pr.Options, or)
+		}
+		if showResults {
+			pr.TotalVotes = &total
+		}
+
+		res[p.ChirpID] = pr
+	}
+
+	return res, nil
+}
+
+func VotePoll(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.FromContext(r.Context()).UserID
+
+		chirpID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		type parameters struct {
+			OptionID uuid.UUID `json:"option_id"`
+		}
+
+		var params parameters
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		poll, err := cfg.Queries.GetPollByChirpID(r.Context(), chirpID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "Poll not found", http.StatusNotFound)
+			} else {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		if !poll.ExpiresAt.After(time.Now().UTC()) {
+			http.Error(w, "Poll is closed", http.StatusConflict)
+			return
+		}
+
+		options, err := cfg.Queries.GetPollOptionsByPollIDs(r.Context(), []uuid.UUID{poll.ID})
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		validOption := false
+		for _, o := range options {
+			if o.ID == params.OptionID {
+				validOption = true
+				break
+			}
+		}
+		if !validOption {
+			http.Error(w, "Invalid option_id", http.StatusBadRequest)
+			return
+		}
+
+		// The (poll_id, user_id) primary key makes the insert the only
+		// arbiter of "one vote per user", even under concurrent requests.
+		inserted, err := cfg.Queries.CreatePollVote(r.Context(), database.CreatePollVoteParams{
+			PollID:   poll.ID,
+			UserID:   userID,
+			OptionID: params.OptionID,
+		})
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if inserted == 0 {
+			http.Error(w, "Already voted", http.StatusConflict)
+			return
+		}
+
+		polls, err := loadPolls(r.Context(), cfg.Queries, []uuid.UUID{chirpID}, userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		respond(w, http.StatusCreated, polls[chirpID])
+	}
+}
@@ -1,14 +1,59 @@
 package handler
 
 import (
-	"encoding/json"
+	"context"
+	"database/sql"
 	"net/http"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/karprabha/chirpy/internal/auth"
 	"github.com/karprabha/chirpy/internal/config"
+	"github.com/karprabha/chirpy/internal/database"
+	"github.com/karprabha/chirpy/internal/policy"
 )
 
+const (
+	accessTokenTTL  = time.Hour
+	refreshTokenTTL = 60 * 24 * time.Hour
+)
+
+// issueAccessToken issues an access token for a session with the user's role
+// and the scopes it grants.
+func issueAccessToken(cfg *config.Config, user database.User, sessionID uuid.UUID) (string, error) {
+	return cfg.JWTKeys.MakeAccessToken(auth.Claims{
+		UserID:    user.ID,
+		SessionID: sessionID,
+		Role:      user.Role,
+		Scopes:    policy.Scopes(user.Role),
+	}, accessTokenTTL)
+}
+
+// issueRefreshToken creates a refresh token in the given family and returns
+// it; only its hash is stored. A family is a login session: Login starts one
+// and every refresh adds the next token to it.
+func issueRefreshToken(ctx context.Context, q *database.Queries, userID, familyID uuid.UUID) (string, error) {
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = q.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+		UserID:    userID,
+		TokenHash: auth.HashRefreshToken(refreshToken),
+		ExpiresAt: time.Now().UTC().Add(refreshTokenTTL),
+		FamilyID:  familyID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return refreshToken, nil
+}
+
+// Refresh exchanges a refresh token for an access token and a new refresh
+// token. The presented token is rotated out; presenting it again means it was
+// copied, so its whole family is revoked and the user has to log in again.
 func Refresh(cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		refreshToken, err := auth.GetBearerToken(r.Header)
@@ -17,12 +62,34 @@ func Refresh(cfg *config.Config) http.HandlerFunc {
 			return
 		}
 
-		rt, err := cfg.Queries.GetRefreshToken(r.Context(), refreshToken)
+		tx, err := cfg.DB.BeginTx(r.Context(), nil)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+		qtx := cfg.Queries.WithTx(tx)
+
+		rt, err := qtx.GetRefreshTokenForUpdate(r.Context(), auth.HashRefreshToken(refreshToken))
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
 
+		if rt.ReplacedBy.Valid {
+			if _, err := revokeSession(r.Context(), qtx, rt.UserID, rt.FamilyID); err != nil {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if err := tx.Commit(); err != nil {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			forgetSessions(cfg, rt.FamilyID)
+			http.Error(w, "refresh token reuse detected", http.StatusUnauthorized)
+			return
+		}
+
 		if rt.ExpiresAt.Before(time.Now()) {
 			http.Error(w, "invalid refresh token", http.StatusUnauthorized)
 			return
@@ -33,30 +100,51 @@ func Refresh(cfg *config.Config) http.HandlerFunc {
 			return
 		}
 
-		expiration := 1 * time.Hour
+		newRefreshToken, err := issueRefreshToken(r.Context(), qtx, rt.UserID, rt.FamilyID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
 
-		token, err := auth.MakeJWT(rt.UserID, cfg.JWTSecret, expiration)
+		err = qtx.RotateRefreshToken(r.Context(), database.RotateRefreshTokenParams{
+			TokenHash:  rt.TokenHash,
+			ReplacedBy: sql.NullString{String: auth.HashRefreshToken(newRefreshToken), Valid: true},
+		})
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 
-		type response struct {
-			Token string `json:"token"`
+		if err := qtx.TouchSession(r.Context(), rt.FamilyID); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
 		}
 
-		res := response{
-			Token: token,
+		user, err := qtx.GetUserByID(r.Context(), rt.UserID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
 		}
 
-		data, err := json.Marshal(res)
+		token, err := issueAccessToken(cfg, user, rt.FamilyID)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		w.Write(data)
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		type response struct {
+			Token        string `json:"token"`
+			RefreshToken string `json:"refresh_token"`
+		}
+
+		respond(w, http.StatusOK, response{
+			Token:        token,
+			RefreshToken: newRefreshToken,
+		})
 	}
 }
@@ -15,17 +15,20 @@ func Revoke(cfg *config.Config) http.HandlerFunc {
 			return
 		}
 
-		rt, err := cfg.Queries.GetRefreshToken(r.Context(), refreshToken)
+		rt, err := cfg.Queries.GetRefreshToken(r.Context(), auth.HashRefreshToken(refreshToken))
 		if err != nil {
 			http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
 			return
 		}
 
-		err = cfg.Queries.RevokeRefreshToken(r.Context(), rt.Token)
+		// Revoking the token ends its whole session, including a token that
+		// was refreshed concurrently.
+		_, err = revokeSession(r.Context(), cfg.Queries, rt.UserID, rt.FamilyID)
 		if err != nil {
 			http.Error(w, "Server error", http.StatusInternalServerError)
 			return
 		}
+		forgetSessions(cfg, rt.FamilyID)
 
 		w.WriteHeader(http.StatusNoContent)
 	}
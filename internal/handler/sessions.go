@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/karprabha/chirpy/internal/auth"
+	"github.com/karprabha/chirpy/internal/config"
+	"github.com/karprabha/chirpy/internal/database"
+)
+
+const maxUserAgentLength = 512
+
+type sessionResponse struct {
+	ID         uuid.UUID `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Current    bool      `json:"current"`
+}
+
+// clientIP returns the address the request came from. Forwarding headers are
+// ignored because they can be set by the client.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// startSession records a new login session for the device making r.
+func startSession(ctx context.Context, q *database.Queries, userID uuid.UUID, r *http.Request) (database.Session, error) {
+	// Headers may hold any bytes, but Postgres only stores valid UTF-8, so
+	// the cut is made on a rune boundary.
+	userAgent := strings.ToValidUTF8(r.UserAgent(), "\uFFFD")
+	if len(userAgent) > maxUserAgentLength {
+		n := maxUserAgentLength
+		for n > 0 && !utf8.RuneStart(userAgent[n]) {
+			n--
+		}
+		userAgent = userAgent[:n]
+	}
+
+	return q.CreateSession(ctx, database.CreateSessionParams{
+		UserID:    userID,
+		UserAgent: userAgent,
+		Ip:        clientIP(r),
+	})
+}
+
+// revokeSession ends a session and every refresh token issued for it. It
+// returns false if the user has no such active session.
+func revokeSession(ctx context.Context, q *database.Queries, userID, sessionID uuid.UUID) (bool, error) {
+	n, err := q.RevokeSession(ctx, database.RevokeSessionParams{
+		ID:     sessionID,
+		UserID: userID,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if err := q.RevokeRefreshTokenFamily(ctx, sessionID); err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+// revokeOtherSessions ends every session of the user except sessionID, with
+// their refresh tokens. It returns the IDs of the sessions it ended.
+func revokeOtherSessions(ctx context.Context, q *database.Queries, userID, sessionID uuid.UUID) ([]uuid.UUID, error) {
+	ended, err := q.RevokeOtherSessions(ctx, database.RevokeOtherSessionsParams{
+		UserID: userID,
+		ID:     sessionID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = q.RevokeOtherRefreshTokens(ctx, database.RevokeOtherRefreshTokensParams{
+		UserID:   userID,
+		FamilyID: sessionID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ended, nil
+}
+
+// forgetSessions makes revoked sessions apply to access tokens checked by
+// this instance immediately rather than after the revocation cache TTL.
+func forgetSessions(cfg *config.Config, sessionIDs ...uuid.UUID) {
+	for _, id := range sessionIDs {
+		cfg.Revocations.ForgetSession(id)
+	}
+}
+
+func GetSessions(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := auth.FromContext(r.Context())
+		userID := claims.UserID
+		sessionID := claims.SessionID
+
+		sessions, err := cfg.Queries.GetActiveSessionsByUserID(r.Context(), userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		response := make([]sessionResponse, len(sessions))
+		for i, s := range sessions {
+			response[i] = sessionResponse{
+				ID:         s.ID,
+				UserAgent:  s.UserAgent,
+				IP:         s.Ip,
+				CreatedAt:  s.CreatedAt,
+				LastUsedAt: s.LastUsedAt,
+				Current:    s.ID == sessionID,
+			}
+		}
+
+		respond(w, http.StatusOK, response)
+	}
+}
+
+func DeleteSession(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.FromContext(r.Context()).UserID
+
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		tx, err := cfg.DB.BeginTx(r.Context(), nil)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		found, err := revokeSession(r.Context(), cfg.Queries.WithTx(tx), userID, id)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		forgetSessions(cfg, id)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// DeleteOtherSessions logs out every session of the caller except the one
+// the access token was issued for.
+func DeleteOtherSessions(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := auth.FromContext(r.Context())
+		userID := claims.UserID
+		sessionID := claims.SessionID
+
+		tx, err := cfg.DB.BeginTx(r.Context(), nil)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		ended, err := revokeOtherSessions(r.Context(), cfg.Queries.WithTx(tx), userID, sessionID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		forgetSessions(cfg, ended...)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/karprabha/chirpy/internal/config"
+)
+
+type subscriptionHistoryResponse struct {
+	ID           uuid.UUID  `json:"id"`
+	Event        string     `json:"event"`
+	IsChirpyRed  bool       `json:"is_chirpy_red"`
+	RedExpiresAt *time.Time `json:"red_expires_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// AdminGetSubscriptionHistory lists the changes to a user's Chirpy Red
+// subscription, oldest first, with the state each one left it in.
+func AdminGetSubscriptionHistory(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		if _, err := cfg.Queries.GetUserByID(r.Context(), id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "User not found", http.StatusNotFound)
+			} else {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		rows, err := cfg.Queries.GetSubscriptionHistoryByUserID(r.Context(), id)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		res := make([]subscriptionHistoryResponse, 0, len(rows))
+		for _, row := range rows {
+			item := subscriptionHistoryResponse{
+				ID:          row.ID,
+				Event:       row.Event,
+				IsChirpyRed: row.IsChirpyRed,
+				CreatedAt:   row.CreatedAt,
+			}
+			if row.RedExpiresAt.Valid {
+				item.RedExpiresAt = &row.RedExpiresAt.Time
+			}
+			res = append(res, item)
+		}
+
+		respond(w, http.StatusOK, res)
+	}
+}
@@ -1,14 +1,24 @@
 package handler
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"net/mail"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/karprabha/chirpy/internal/auth"
 	"github.com/karprabha/chirpy/internal/config"
 	"github.com/karprabha/chirpy/internal/database"
+	"github.com/karprabha/chirpy/internal/entitlements"
+	"github.com/karprabha/chirpy/internal/mailer"
+	"github.com/karprabha/chirpy/internal/passwordpolicy"
+	"github.com/lib/pq"
 )
 
 func CreateUser(cfg *config.Config) http.HandlerFunc {
@@ -28,6 +38,14 @@ func CreateUser(cfg *config.Config) http.HandlerFunc {
 			http.Error(w, "email and password are required", http.StatusBadRequest)
 			return
 		}
+		if _, err := mail.ParseAddress(p.Email); err != nil {
+			http.Error(w, "Invalid email address", http.StatusBadRequest)
+			return
+		}
+
+		if !checkPassword(w, r, cfg, p.Password, p.Email) {
+			return
+		}
 
 		hashedPassword, err := auth.HashPassword(p.Password)
 		if err != nil {
@@ -42,24 +60,37 @@ func CreateUser(cfg *config.Config) http.HandlerFunc {
 
 		user, err := cfg.Queries.CreateUser(r.Context(), createUserParams)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			if isUniqueViolation(err) {
+				http.Error(w, "Email is already in use", http.StatusConflict)
+			} else {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
 			return
 		}
 
+		// The account is usable without a verified email unless
+		// REQUIRE_VERIFIED_EMAIL is set, and the user can ask for another
+		// link, so a mail failure doesn't fail the signup.
+		if err := sendVerificationEmail(r.Context(), cfg, user); err != nil {
+			log.Printf("Failed to send verification email to user %s: %v", user.ID, err)
+		}
+
 		type response struct {
-			ID          uuid.UUID `json:"id"`
-			Email       string    `json:"email"`
-			IsChirpyRed bool      `json:"is_chirpy_red"`
-			CreatedAt   time.Time `json:"created_at"`
-			UpdatedAt   time.Time `json:"updated_at"`
+			ID            uuid.UUID `json:"id"`
+			Email         string    `json:"email"`
+			EmailVerified bool      `json:"email_verified"`
+			IsChirpyRed   bool      `json:"is_chirpy_red"`
+			CreatedAt     time.Time `json:"created_at"`
+			UpdatedAt     time.Time `json:"updated_at"`
 		}
 
 		resp := response{
-			ID:          user.ID,
-			Email:       user.Email,
-			IsChirpyRed: user.IsChirpyRed,
-			CreatedAt:   user.CreatedAt,
-			UpdatedAt:   user.UpdatedAt,
+			ID:            user.ID,
+			Email:         user.Email,
+			EmailVerified: user.EmailVerifiedAt.Valid,
+			IsChirpyRed:   user.IsChirpyRed,
+			CreatedAt:     user.CreatedAt,
+			UpdatedAt:     user.UpdatedAt,
 		}
 
 		data, err := json.Marshal(resp)
@@ -74,20 +105,314 @@ func CreateUser(cfg *config.Config) http.HandlerFunc {
 	}
 }
 
-func UpdateUser(cfg *config.Config) http.HandlerFunc {
+// UpdateUser answered PUT /api/users, which changed the email and password
+// without the current password. It now only points clients to the
+// endpoints that replaced it. It needs no token, so clients whose token has
+// expired still learn why.
+func UpdateUser(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, "PUT /api/users has been removed: use POST /api/users/me/password "+
+		"to change the password and POST /api/users/me/email to change the email", http.StatusGone)
+}
+
+func UpdatePreferences(cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		token, err := auth.GetBearerToken(r.Header)
+		userID := auth.FromContext(r.Context()).UserID
+
+		type params struct {
+			ExpandSensitive bool `json:"expand_sensitive"`
+		}
+
+		var p params
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		user, err := cfg.Queries.UpdateUserPreferences(r.Context(), database.UpdateUserPreferencesParams{
+			ID:              userID,
+			ExpandSensitive: p.ExpandSensitive,
+		})
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
+			http.Error(w, "Server error", http.StatusInternalServerError)
 			return
 		}
 
-		userID, err := auth.ValidateJWT(token, cfg.JWTSecret)
+		type response struct {
+			ExpandSensitive bool `json:"expand_sensitive"`
+		}
+
+		respond(w, http.StatusOK, response{ExpandSensitive: user.ExpandSensitive})
+	}
+}
+
+func GetEntitlements(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.FromContext(r.Context()).UserID
+
+		user, err := cfg.Queries.GetUserByID(r.Context(), userID)
 		if err != nil {
 			http.Error(w, "Unauthorized: Invalid or expired token", http.StatusUnauthorized)
 			return
 		}
 
+		// Only limits something enforces are listed; the rest are added as
+		// their features are built.
+		type limitsResponse struct {
+			MaxChirpLength int `json:"max_chirp_length"`
+			ChirpsPerHour  int `json:"chirps_per_hour"`
+		}
+		type response struct {
+			Tier   entitlements.Tier `json:"tier"`
+			Limits limitsResponse    `json:"limits"`
+		}
+
+		limits := cfg.Tiers.For(user.IsChirpyRed)
+		respond(w, http.StatusOK, response{
+			Tier: entitlements.TierFor(user.IsChirpyRed),
+			Limits: limitsResponse{
+				MaxChirpLength: limits.MaxChirpLength,
+				ChirpsPerHour:  limits.ChirpsPerHour,
+			},
+		})
+	}
+}
+
+// isUniqueViolation reports whether err is a PostgreSQL unique constraint
+// violation, such as an email that is already in use.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// checkPassword applies the password policy to a password the user with
+// email is setting. If the password is refused it responds 400 with every
+// rule it breaks and returns false.
+func checkPassword(w http.ResponseWriter, r *http.Request, cfg *config.Config, password, email string) bool {
+	violations, err := cfg.PasswordPolicy.Check(r.Context(), password, email)
+	if err != nil {
+		log.Printf("Failed to check password against policy: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return false
+	}
+	if len(violations) == 0 {
+		return true
+	}
+
+	type response struct {
+		Error      string                     `json:"error"`
+		Violations []passwordpolicy.Violation `json:"violations"`
+	}
+
+	respond(w, http.StatusBadRequest, response{
+		Error:      "Password does not meet the requirements",
+		Violations: violations,
+	})
+	return false
+}
+
+// logOutAfterPasswordChange revokes everything a new password should: every
+// access token issued so far, every session except sessionID and any unused
+// password reset and email change links. The caller keeps sessionID and gets
+// a new access token with /api/refresh; uuid.Nil ends every session. It
+// returns the IDs of the sessions it ended.
+func logOutAfterPasswordChange(ctx context.Context, q *database.Queries, userID, sessionID uuid.UUID) ([]uuid.UUID, error) {
+	if err := q.InvalidateUserAccessTokens(ctx, userID); err != nil {
+		return nil, err
+	}
+	if err := q.UseUserPasswordResetTokens(ctx, userID); err != nil {
+		return nil, err
+	}
+	if err := q.UseUserEmailChangeTokens(ctx, userID); err != nil {
+		return nil, err
+	}
+	return revokeOtherSessions(ctx, q, userID, sessionID)
+}
+
+type profileResponse struct {
+	ID              uuid.UUID `json:"id"`
+	Email           string    `json:"email"`
+	EmailVerified   bool      `json:"email_verified"`
+	IsChirpyRed     bool      `json:"is_chirpy_red"`
+	Role            string    `json:"role"`
+	ExpandSensitive bool      `json:"expand_sensitive"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+func newProfileResponse(u database.User) profileResponse {
+	return profileResponse{
+		ID:              u.ID,
+		Email:           u.Email,
+		EmailVerified:   u.EmailVerifiedAt.Valid,
+		IsChirpyRed:     u.IsChirpyRed,
+		Role:            u.Role,
+		ExpandSensitive: u.ExpandSensitive,
+		CreatedAt:       u.CreatedAt,
+		UpdatedAt:       u.UpdatedAt,
+	}
+}
+
+func GetMe(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.FromContext(r.Context()).UserID
+
+		user, err := cfg.Queries.GetUserByID(r.Context(), userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		respond(w, http.StatusOK, newProfileResponse(user))
+	}
+}
+
+// UpdateMe changes the fields of the caller's profile that are present in the
+// request and leaves the rest alone. The email and password have their own
+// endpoints, which ask for the current password.
+func UpdateMe(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.FromContext(r.Context()).UserID
+
+		type params struct {
+			ExpandSensitive *bool `json:"expand_sensitive"`
+
+			Email    *string `json:"email"`
+			Password *string `json:"password"`
+		}
+
+		var p params
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if p.Email != nil {
+			http.Error(w, "Change the email with POST /api/users/me/email", http.StatusBadRequest)
+			return
+		}
+		if p.Password != nil {
+			http.Error(w, "Change the password with POST /api/users/me/password", http.StatusBadRequest)
+			return
+		}
+
+		var user database.User
+		var err error
+		if p.ExpandSensitive != nil {
+			user, err = cfg.Queries.UpdateUserPreferences(r.Context(), database.UpdateUserPreferencesParams{
+				ID:              userID,
+				ExpandSensitive: *p.ExpandSensitive,
+			})
+		} else {
+			user, err = cfg.Queries.GetUserByID(r.Context(), userID)
+		}
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		respond(w, http.StatusOK, newProfileResponse(user))
+	}
+}
+
+// ChangePassword sets a new password for the caller after checking the
+// current one. Like a password reset, it revokes every access token and
+// logs out every other session.
+func ChangePassword(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := auth.FromContext(r.Context())
+
+		type params struct {
+			CurrentPassword string `json:"current_password"`
+			NewPassword     string `json:"new_password"`
+		}
+
+		var p params
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if p.CurrentPassword == "" || p.NewPassword == "" {
+			http.Error(w, "current_password and new_password are required", http.StatusBadRequest)
+			return
+		}
+
+		user, err := cfg.Queries.GetUserByID(r.Context(), claims.UserID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		keys, ok := reserveReauthAttempt(w, r, cfg, user.Email)
+		if !ok {
+			return
+		}
+		if auth.CheckPasswordHash(p.CurrentPassword, user.HashedPassword) != nil {
+			http.Error(w, "Current password is incorrect", http.StatusForbidden)
+			return
+		}
+		if err := acceptLoginAttempt(r.Context(), cfg.Queries, keys, true); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if p.NewPassword == p.CurrentPassword {
+			http.Error(w, "New password must be different", http.StatusBadRequest)
+			return
+		}
+		if !checkPassword(w, r, cfg, p.NewPassword, user.Email) {
+			return
+		}
+
+		hashedPassword, err := auth.HashPassword(p.NewPassword)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		tx, err := cfg.DB.BeginTx(r.Context(), nil)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+		qtx := cfg.Queries.WithTx(tx)
+
+		if _, err := qtx.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+			ID:             claims.UserID,
+			HashedPassword: hashedPassword,
+		}); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		ended, err := logOutAfterPasswordChange(r.Context(), qtx, claims.UserID, claims.SessionID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		cfg.Revocations.ForgetUser(claims.UserID)
+		forgetSessions(cfg, ended...)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+const emailChangeTTL = 24 * time.Hour
+
+// ChangeEmail starts changing the caller's email after checking their
+// password. The email stays the same until the link mailed to the new
+// address is opened and ConfirmEmailChange is called. The link works once,
+// only while the account still has its current email, and stops working
+// when a newer link is sent or the password changes.
+func ChangeEmail(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.FromContext(r.Context()).UserID
+
 		type params struct {
 			Email    string `json:"email"`
 			Password string `json:"password"`
@@ -95,7 +420,7 @@ func UpdateUser(cfg *config.Config) http.HandlerFunc {
 
 		var p params
 		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
-			http.Error(w, "Server error", http.StatusBadRequest)
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
 			return
 		}
 
@@ -103,49 +428,155 @@ func UpdateUser(cfg *config.Config) http.HandlerFunc {
 			http.Error(w, "email and password are required", http.StatusBadRequest)
 			return
 		}
+		if _, err := mail.ParseAddress(p.Email); err != nil {
+			http.Error(w, "Invalid email address", http.StatusBadRequest)
+			return
+		}
 
-		hashedPassword, err := auth.HashPassword(p.Password)
+		user, err := cfg.Queries.GetUserByID(r.Context(), userID)
 		if err != nil {
-			http.Error(w, "Server error", http.StatusInternalServerError)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 
-		updateUserParams := database.UpdateUserParams{
-			ID:             userID,
-			Email:          p.Email,
-			HashedPassword: hashedPassword,
+		keys, ok := reserveReauthAttempt(w, r, cfg, user.Email)
+		if !ok {
+			return
+		}
+		if auth.CheckPasswordHash(p.Password, user.HashedPassword) != nil {
+			http.Error(w, "Password is incorrect", http.StatusForbidden)
+			return
+		}
+		if err := acceptLoginAttempt(r.Context(), cfg.Queries, keys, true); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if p.Email == user.Email {
+			http.Error(w, "That is already your email", http.StatusBadRequest)
+			return
+		}
+
+		_, err = cfg.Queries.GetUserByEmail(r.Context(), p.Email)
+		if err == nil {
+			http.Error(w, "Email is already in use", http.StatusConflict)
+			return
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
 		}
 
-		user, err := cfg.Queries.UpdateUser(r.Context(), updateUserParams)
+		token, err := auth.MakeEmailChangeToken()
 		if err != nil {
-			http.Error(w, "Server error", http.StatusInternalServerError)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 
-		type response struct {
-			ID          uuid.UUID `json:"id"`
-			Email       string    `json:"email"`
-			IsChirpyRed bool      `json:"is_chirpy_red"`
-			CreatedAt   time.Time `json:"created_at"`
-			UpdatedAt   time.Time `json:"updated_at"`
+		if err := cfg.Queries.DeleteExpiredEmailChangeTokens(r.Context()); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
 		}
 
-		resp := response{
-			ID:          user.ID,
-			Email:       user.Email,
-			IsChirpyRed: user.IsChirpyRed,
-			CreatedAt:   user.CreatedAt,
-			UpdatedAt:   user.UpdatedAt,
+		// Only the latest link works.
+		if err := cfg.Queries.UseUserEmailChangeTokens(r.Context(), userID); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
 		}
 
-		data, err := json.Marshal(resp)
+		err = cfg.Queries.CreateEmailChangeToken(r.Context(), database.CreateEmailChangeTokenParams{
+			TokenHash: auth.HashRefreshToken(token),
+			UserID:    userID,
+			OldEmail:  user.Email,
+			NewEmail:  p.Email,
+			ExpiresAt: time.Now().UTC().Add(emailChangeTTL),
+		})
 		if err != nil {
-			http.Error(w, "Server error", http.StatusInternalServerError)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		w.Write(data)
+		err = cfg.Mailer.Send(r.Context(), mailer.Message{
+			To:      p.Email,
+			Subject: "Confirm your new email for Chirpy",
+			Body: fmt.Sprintf("Confirm you want to use this address for your Chirpy account by opening the link below:\n\n%s\n\n"+
+				"The link expires in 24 hours. If you didn't ask for this, you can ignore this email.\n",
+				appLink(cfg, "confirm-email", token)),
+		})
+		if err != nil {
+			http.Error(w, "Failed to send email", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// ConfirmEmailChange switches the user to the new email with the token
+// mailed to it by ChangeEmail. The new email is verified, since the token
+// proves the user received mail there.
+func ConfirmEmailChange(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type params struct {
+			Token string `json:"token"`
+		}
+
+		var p params
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if p.Token == "" {
+			http.Error(w, "token is required", http.StatusBadRequest)
+			return
+		}
+
+		tx, err := cfg.DB.BeginTx(r.Context(), nil)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+		qtx := cfg.Queries.WithTx(tx)
+
+		token, err := qtx.GetEmailChangeTokenForUpdate(r.Context(), auth.HashRefreshToken(p.Token))
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if err != nil || token.UsedAt.Valid || token.ExpiresAt.Before(time.Now().UTC()) {
+			http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+			return
+		}
+
+		// The token only works while the account still has the email it
+		// was issued for.
+		user, err := qtx.UpdateUserEmail(r.Context(), database.UpdateUserEmailParams{
+			ID:       token.UserID,
+			Email:    token.NewEmail,
+			OldEmail: token.OldEmail,
+		})
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+			} else if isUniqueViolation(err) {
+				http.Error(w, "Email is already in use", http.StatusConflict)
+			} else {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		if err := qtx.UseUserEmailChangeTokens(r.Context(), user.ID); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		respond(w, http.StatusOK, newProfileResponse(user))
 	}
 }
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/karprabha/chirpy/internal/auth"
+	"github.com/karprabha/chirpy/internal/config"
+	"github.com/karprabha/chirpy/internal/database"
+	"github.com/karprabha/chirpy/internal/mailer"
+)
+
+const emailVerificationTTL = 24 * time.Hour
+
+// appLink returns a link to a page of the web app with token in the query
+// string. The page sends the token on to the API.
+func appLink(cfg *config.Config, page, token string) string {
+	return cfg.AppURL + "/" + page + "?token=" + url.QueryEscape(token)
+}
+
+// sendVerificationEmail mails user a link to confirm they own their address.
+func sendVerificationEmail(ctx context.Context, cfg *config.Config, user database.User) error {
+	token, err := cfg.JWTKeys.MakeEmailToken(auth.PurposeVerifyEmail, user.ID, user.Email, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	return cfg.Mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email for Chirpy",
+		Body: fmt.Sprintf("Confirm this is your email address by opening the link below:\n\n%s\n\n"+
+			"The link expires in 24 hours. If you didn't sign up for Chirpy, you can ignore this email.\n",
+			appLink(cfg, "verify-email", token)),
+	})
+}
+
+// VerifyEmail marks the user's address verified with a token from the
+// verification email. A token only works for the address it was sent to.
+func VerifyEmail(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type params struct {
+			Token string `json:"token"`
+		}
+
+		var p params
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		userID, email, err := cfg.JWTKeys.ValidateEmailToken(auth.PurposeVerifyEmail, p.Token)
+		if err != nil {
+			http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+			return
+		}
+
+		user, err := cfg.Queries.VerifyUserEmail(r.Context(), database.VerifyUserEmailParams{
+			ID:    userID,
+			Email: email,
+		})
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+			} else {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		type response struct {
+			Email           string    `json:"email"`
+			EmailVerifiedAt time.Time `json:"email_verified_at"`
+		}
+
+		respond(w, http.StatusOK, response{
+			Email:           user.Email,
+			EmailVerifiedAt: user.EmailVerifiedAt.Time,
+		})
+	}
+}
+
+// ResendVerificationEmail sends the caller a new verification link.
+func ResendVerificationEmail(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.FromContext(r.Context()).UserID
+
+		user, err := cfg.Queries.GetUserByID(r.Context(), userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if user.EmailVerifiedAt.Valid {
+			http.Error(w, "Email is already verified", http.StatusConflict)
+			return
+		}
+
+		if err := sendVerificationEmail(r.Context(), cfg, user); err != nil {
+			http.Error(w, "Failed to send email", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
@@ -0,0 +1,258 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/karprabha/chirpy/internal/auth"
+	"github.com/karprabha/chirpy/internal/config"
+	"github.com/karprabha/chirpy/internal/database"
+	"github.com/karprabha/chirpy/internal/outbound"
+)
+
+const webhookDeliveriesLimit = 100
+
+type webhookEndpointResponse struct {
+	ID           uuid.UUID  `json:"id"`
+	URL          string     `json:"url"`
+	Events       []string   `json:"events"`
+	Secret       string     `json:"secret,omitempty"`
+	Enabled      bool       `json:"enabled"`
+	FailureCount int32      `json:"failure_count"`
+	DisabledAt   *time.Time `json:"disabled_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+func newWebhookEndpointResponse(e database.WebhookEndpoint) webhookEndpointResponse {
+	res := webhookEndpointResponse{
+		ID:           e.ID,
+		URL:          e.Url,
+		Events:       e.Events,
+		Enabled:      e.Enabled,
+		FailureCount: e.FailureCount,
+		CreatedAt:    e.CreatedAt,
+		UpdatedAt:    e.UpdatedAt,
+	}
+	if e.DisabledAt.Valid {
+		res.DisabledAt = &e.DisabledAt.Time
+	}
+	return res
+}
+
+type webhookDeliveryResponse struct {
+	ID             uuid.UUID       `json:"id"`
+	EventID        uuid.UUID       `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int32           `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at"`
+	ResponseStatus *int32          `json:"response_status"`
+	Error          string          `json:"error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+}
+
+func newWebhookDeliveryResponse(d database.WebhookDelivery) webhookDeliveryResponse {
+	res := webhookDeliveryResponse{
+		ID:        d.ID,
+		EventID:   d.EventID,
+		EventType: d.EventType,
+		Payload:   d.Payload,
+		Status:    d.Status,
+		Attempts:  d.Attempts,
+		Error:     d.Error.String,
+		CreatedAt: d.CreatedAt,
+	}
+	if d.Status == outbound.StatusPending {
+		res.NextAttemptAt = &d.NextAttemptAt
+	}
+	if d.LastAttemptAt.Valid {
+		res.LastAttemptAt = &d.LastAttemptAt.Time
+	}
+	if d.ResponseStatus.Valid {
+		res.ResponseStatus = &d.ResponseStatus.Int32
+	}
+	if d.DeliveredAt.Valid {
+		res.DeliveredAt = &d.DeliveredAt.Time
+	}
+	return res
+}
+
+func CreateWebhookEndpoint(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.FromContext(r.Context()).UserID
+
+		type params struct {
+			URL    string   `json:"url"`
+			Events []string `json:"events"`
+		}
+
+		var p params
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if err := outbound.CheckURL(r.Context(), p.URL, cfg.AllowPrivateWebhooks); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if len(p.Events) == 0 {
+			http.Error(w, "events is required", http.StatusBadRequest)
+			return
+		}
+		for _, event := range p.Events {
+			if !outbound.ValidEvent(event) {
+				http.Error(w, "Unknown event: "+event, http.StatusBadRequest)
+				return
+			}
+		}
+		slices.Sort(p.Events)
+		p.Events = slices.Compact(p.Events)
+
+		secret, err := outbound.MakeSecret()
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		endpoint, err := cfg.Queries.CreateWebhookEndpoint(r.Context(), database.CreateWebhookEndpointParams{
+			UserID: userID,
+			Url:    p.URL,
+			Secret: secret,
+			Events: p.Events,
+		})
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		// The secret is only ever returned here.
+		res := newWebhookEndpointResponse(endpoint)
+		res.Secret = endpoint.Secret
+
+		respond(w, http.StatusCreated, res)
+	}
+}
+
+func GetWebhookEndpoints(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.FromContext(r.Context()).UserID
+
+		endpoints, err := cfg.Queries.ListWebhookEndpointsByUserID(r.Context(), userID)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		response := make([]webhookEndpointResponse, len(endpoints))
+		for i, e := range endpoints {
+			response[i] = newWebhookEndpointResponse(e)
+		}
+
+		respond(w, http.StatusOK, response)
+	}
+}
+
+func DeleteWebhookEndpoint(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.FromContext(r.Context()).UserID
+
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		n, err := cfg.Queries.DeleteWebhookEndpoint(r.Context(), database.DeleteWebhookEndpointParams{
+			ID:     id,
+			UserID: userID,
+		})
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if n == 0 {
+			http.Error(w, "Webhook endpoint not found", http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// EnableWebhookEndpoint turns an endpoint back on after it was disabled for
+// failing. Deliveries still pending are retried.
+func EnableWebhookEndpoint(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.FromContext(r.Context()).UserID
+
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		endpoint, err := cfg.Queries.EnableWebhookEndpoint(r.Context(), database.EnableWebhookEndpointParams{
+			ID:     id,
+			UserID: userID,
+		})
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "Webhook endpoint not found", http.StatusNotFound)
+			} else {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		respond(w, http.StatusOK, newWebhookEndpointResponse(endpoint))
+	}
+}
+
+func GetWebhookDeliveries(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.FromContext(r.Context()).UserID
+
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		endpoint, err := cfg.Queries.GetWebhookEndpoint(r.Context(), id)
+		if err != nil || endpoint.UserID != userID {
+			if err == nil || errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "Webhook endpoint not found", http.StatusNotFound)
+			} else {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		deliveries, err := cfg.Queries.ListWebhookDeliveriesByEndpointID(r.Context(), database.ListWebhookDeliveriesByEndpointIDParams{
+			EndpointID: endpoint.ID,
+			Limit:      webhookDeliveriesLimit,
+		})
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		response := make([]webhookDeliveryResponse, len(deliveries))
+		for i, d := range deliveries {
+			response[i] = newWebhookDeliveryResponse(d)
+		}
+
+		respond(w, http.StatusOK, response)
+	}
+}
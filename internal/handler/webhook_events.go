@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/karprabha/chirpy/internal/config"
+	"github.com/karprabha/chirpy/internal/database"
+)
+
+const (
+	defaultWebhookEventsLimit = 50
+	maxWebhookEventsLimit     = 200
+)
+
+type webhookEventResponse struct {
+	ID          uuid.UUID       `json:"id"`
+	Provider    string          `json:"provider"`
+	EventID     string          `json:"event_id"`
+	EventType   string          `json:"event_type"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+	OccurredAt  *time.Time      `json:"occurred_at"`
+	ReceivedAt  time.Time       `json:"received_at"`
+	ProcessedAt *time.Time      `json:"processed_at"`
+	Outcome     string          `json:"outcome"`
+	Error       string          `json:"error,omitempty"`
+	Attempts    int32           `json:"attempts"`
+}
+
+func newWebhookEventResponse(e database.WebhookEvent, withPayload bool) webhookEventResponse {
+	res := webhookEventResponse{
+		ID:         e.ID,
+		Provider:   e.Provider,
+		EventID:    e.EventID,
+		EventType:  e.EventType,
+		ReceivedAt: e.ReceivedAt,
+		Outcome:    e.Outcome,
+		Error:      e.Error.String,
+		Attempts:   e.Attempts,
+	}
+	if withPayload {
+		res.Payload = e.Payload
+	}
+	if e.OccurredAt.Valid {
+		res.OccurredAt = &e.OccurredAt.Time
+	}
+	if e.ProcessedAt.Valid {
+		res.ProcessedAt = &e.ProcessedAt.Time
+	}
+	return res
+}
+
+func optionalString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func AdminListWebhookEvents(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		limit := defaultWebhookEventsLimit
+		if v := query.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxWebhookEventsLimit {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+
+		offset := 0
+		if v := query.Get("offset"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "Invalid offset", http.StatusBadRequest)
+				return
+			}
+			offset = n
+		}
+
+		userID := query.Get("user_id")
+		if userID != "" {
+			if _, err := uuid.Parse(userID); err != nil {
+				http.Error(w, "Invalid user_id", http.StatusBadRequest)
+				return
+			}
+		}
+
+		events, err := cfg.Queries.ListWebhookEvents(r.Context(), database.ListWebhookEventsParams{
+			Provider:  optionalString(query.Get("provider")),
+			EventType: optionalString(query.Get("event_type")),
+			Outcome:   optionalString(query.Get("outcome")),
+			UserID:    optionalString(userID),
+			Limit:     int32(limit),
+			Offset:    int32(offset),
+		})
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		response := make([]webhookEventResponse, len(events))
+		for i, e := range events {
+			response[i] = newWebhookEventResponse(e, false)
+		}
+
+		respond(w, http.StatusOK, response)
+	}
+}
+
+func AdminGetWebhookEvent(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		event, err := cfg.Queries.GetWebhookEvent(r.Context(), id)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "Webhook event not found", http.StatusNotFound)
+			} else {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		respond(w, http.StatusOK, newWebhookEventResponse(event, true))
+	}
+}
+
+// AdminReplayWebhookEvent re-runs processing of a stored event that has not
+// been processed yet, typically one that failed or was rejected. The stored
+// payload is used as is and the timestamp window is not enforced.
+func AdminReplayWebhookEvent(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+
+		event, err := cfg.Queries.GetWebhookEvent(r.Context(), id)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "Webhook event not found", http.StatusNotFound)
+			} else {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		if event.Provider != polkaProvider {
+			http.Error(w, "Unsupported webhook provider", http.StatusBadRequest)
+			return
+		}
+
+		if event.ProcessedAt.Valid {
+			http.Error(w, "Webhook event already processed", http.StatusConflict)
+			return
+		}
+
+		e, err := parsePolkaEvent(event.Payload, event.ReceivedAt)
+		if err != nil {
+			http.Error(w, "Unable to parse stored payload", http.StatusUnprocessableEntity)
+			return
+		}
+		e.ID = event.EventID
+		if event.OccurredAt.Valid {
+			e.OccurredAt = event.OccurredAt.Time
+		}
+
+		_, err = processPolkaEvent(r.Context(), cfg, e)
+		switch {
+		case errors.Is(err, errDuplicateWebhook):
+			http.Error(w, "Webhook event already processed", http.StatusConflict)
+			return
+		case errors.Is(err, sql.ErrNoRows):
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		case err != nil:
+			http.Error(w, "Failed to process webhook event", http.StatusInternalServerError)
+			return
+		}
+
+		event, err = cfg.Queries.GetWebhookEvent(r.Context(), id)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		respond(w, http.StatusOK, newWebhookEventResponse(event, true))
+	}
+}
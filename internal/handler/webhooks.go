@@ -1,60 +1,227 @@
 package handler
 
 import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"io"
+	"log"
 	"net/http"
+	"time"
 
 	"github.com/google/uuid"
-	"github.com/karprabha/chirpy/internal/auth"
 	"github.com/karprabha/chirpy/internal/config"
 	"github.com/karprabha/chirpy/internal/database"
+	"github.com/karprabha/chirpy/internal/outbound"
+	"github.com/karprabha/chirpy/internal/subscription"
 )
 
-func PolkaWebhook(cfg *config.Config) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		apiKey, err := auth.GetAPIKey(r.Header)
-		if err != nil {
-			http.Error(w, "Invalid API key", http.StatusUnauthorized)
-			return
+const polkaProvider = "polka"
+
+// Outcomes recorded in webhook_events.outcome.
+const (
+	webhookOutcomeProcessed = "processed"
+	webhookOutcomeIgnored   = "ignored"
+	webhookOutcomeStale     = "stale"
+	webhookOutcomeRejected  = "rejected"
+	webhookOutcomeFailed    = "failed"
+)
+
+// maxWebhookClockSkew is how far in the future an event timestamp may be
+// before it is rejected.
+const maxWebhookClockSkew = 5 * time.Minute
+
+var errDuplicateWebhook = errors.New("webhook event already processed")
+
+// polkaEvent is a parsed Polka delivery. Deliveries without an id are keyed
+// by a hash of the raw body so that identical retries are still de-duplicated.
+type polkaEvent struct {
+	ID         string
+	Type       string
+	OccurredAt time.Time
+	UserID     uuid.UUID
+	ExpiresAt  *time.Time
+	Payload    json.RawMessage
+}
+
+func parsePolkaEvent(raw []byte, receivedAt time.Time) (polkaEvent, error) {
+	var p struct {
+		ID        string     `json:"id"`
+		Event     string     `json:"event"`
+		CreatedAt *time.Time `json:"created_at"`
+		Data      struct {
+			UserID    uuid.UUID  `json:"user_id"`
+			ExpiresAt *time.Time `json:"expires_at"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return polkaEvent{}, err
+	}
+
+	e := polkaEvent{
+		ID:         p.ID,
+		Type:       p.Event,
+		OccurredAt: receivedAt.UTC(),
+		UserID:     p.Data.UserID,
+		ExpiresAt:  p.Data.ExpiresAt,
+		Payload:    raw,
+	}
+	if e.ID == "" {
+		sum := sha256.Sum256(raw)
+		e.ID = "sha256:" + hex.EncodeToString(sum[:])
+	}
+	if p.CreatedAt != nil {
+		e.OccurredAt = p.CreatedAt.UTC()
+	}
+	return e, nil
+}
+
+// processPolkaEvent records e in webhook_events and applies it at most once.
+// The event row and the subscription change are written in one transaction,
+// so a retry that races the original delivery waits on the row lock and then
+// sees it as processed. Failures are recorded outside the rolled back
+// transaction so they stay visible.
+func processPolkaEvent(ctx context.Context, cfg *config.Config, e polkaEvent) (string, error) {
+	outcome, err := applyPolkaEvent(ctx, cfg, e)
+	if err != nil && !errors.Is(err, errDuplicateWebhook) {
+		if recErr := recordPolkaEventFailure(ctx, cfg, e, webhookOutcomeFailed, err); recErr != nil {
+			log.Printf("Failed to record webhook event %s: %v", e.ID, recErr)
 		}
+	}
+	return outcome, err
+}
 
-		if apiKey != cfg.PolkaKey {
-			http.Error(w, "Invalid API key", http.StatusUnauthorized)
-			return
+func applyPolkaEvent(ctx context.Context, cfg *config.Config, e polkaEvent) (string, error) {
+	tx, err := cfg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	qtx := cfg.Queries.WithTx(tx)
+	event, err := qtx.UpsertWebhookEvent(ctx, database.UpsertWebhookEventParams{
+		Provider:   polkaProvider,
+		EventID:    e.ID,
+		EventType:  e.Type,
+		Payload:    e.Payload,
+		OccurredAt: sql.NullTime{Time: e.OccurredAt, Valid: true},
+	})
+	if err != nil {
+		return "", err
+	}
+	if event.ProcessedAt.Valid {
+		// Commit so the extra delivery attempt is counted.
+		if err := tx.Commit(); err != nil {
+			return "", err
 		}
+		return event.Outcome, errDuplicateWebhook
+	}
 
-		type params struct {
-			Event string `json:"event"`
-			Data  struct {
-				UserID uuid.UUID `json:"user_id"`
-			} `json:"data"`
+	outcome := webhookOutcomeIgnored
+	if subscription.Handles(e.Type) {
+		user, err := subscription.Apply(ctx, qtx, subscription.Event{
+			Type:       e.Type,
+			UserID:     e.UserID,
+			ExpiresAt:  e.ExpiresAt,
+			OccurredAt: e.OccurredAt,
+		}, cfg.RedPeriod)
+		switch {
+		case errors.Is(err, subscription.ErrStaleEvent):
+			outcome = webhookOutcomeStale
+		case err != nil:
+			return "", err
+		default:
+			outcome = webhookOutcomeProcessed
 		}
 
-		var p params
-		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
-			http.Error(w, "Unable to parse JSON", http.StatusBadRequest)
-			return
+		if outcome == webhookOutcomeProcessed && e.Type == subscription.EventUpgraded {
+			if err := outbound.Enqueue(ctx, qtx, user.ID, outbound.EventUserUpgraded, newSubscriptionData(user)); err != nil {
+				return "", err
+			}
 		}
+	}
+
+	if err := qtx.MarkWebhookEventProcessed(ctx, database.MarkWebhookEventProcessedParams{
+		ID:      event.ID,
+		Outcome: outcome,
+	}); err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return outcome, nil
+}
+
+type subscriptionData struct {
+	UserID       uuid.UUID  `json:"user_id"`
+	IsChirpyRed  bool       `json:"is_chirpy_red"`
+	RedExpiresAt *time.Time `json:"red_expires_at"`
+}
 
-		if p.Event != "user.upgraded" {
-			w.WriteHeader(http.StatusNoContent)
+func newSubscriptionData(u database.User) subscriptionData {
+	data := subscriptionData{UserID: u.ID, IsChirpyRed: u.IsChirpyRed}
+	if u.RedExpiresAt.Valid {
+		data.RedExpiresAt = &u.RedExpiresAt.Time
+	}
+	return data
+}
+
+// recordPolkaEventFailure stores why e wasn't applied. The caller is
+// already failing the delivery, so an error here is only worth logging.
+func recordPolkaEventFailure(ctx context.Context, cfg *config.Config, e polkaEvent, outcome string, cause error) error {
+	msg := cause.Error()
+	if errors.Is(cause, sql.ErrNoRows) {
+		msg = "user not found"
+	}
+	return cfg.Queries.RecordWebhookEventFailure(ctx, database.RecordWebhookEventFailureParams{
+		Provider:   polkaProvider,
+		EventID:    e.ID,
+		EventType:  e.Type,
+		Payload:    e.Payload,
+		OccurredAt: sql.NullTime{Time: e.OccurredAt, Valid: true},
+		Outcome:    outcome,
+		Error:      sql.NullString{String: msg, Valid: true},
+	})
+}
+
+// PolkaWebhook expects the caller to be authenticated by middleware, either
+// with the Polka API key or a signature.
+func PolkaWebhook(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		raw, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Unable to read request body", http.StatusBadRequest)
 			return
 		}
 
-		user, err := cfg.Queries.GetUserByID(r.Context(), p.Data.UserID)
+		now := time.Now().UTC()
+		e, err := parsePolkaEvent(raw, now)
 		if err != nil {
-			http.Error(w, "User not found", http.StatusNotFound)
+			http.Error(w, "Unable to parse JSON", http.StatusBadRequest)
 			return
 		}
 
-		updateUserIsChirpyRedParams := database.UpdateUserIsChirpyRedParams{
-			ID:          user.ID,
-			IsChirpyRed: true,
+		if e.OccurredAt.Before(now.Add(-cfg.WebhookMaxAge)) || e.OccurredAt.After(now.Add(maxWebhookClockSkew)) {
+			cause := errors.New("event timestamp outside the accepted window")
+			if err := recordPolkaEventFailure(r.Context(), cfg, e, webhookOutcomeRejected, cause); err != nil {
+				log.Printf("Failed to record webhook event %s: %v", e.ID, err)
+			}
+			http.Error(w, "Event timestamp outside the accepted window", http.StatusBadRequest)
+			return
 		}
 
-		user, err = cfg.Queries.UpdateUserIsChirpyRed(r.Context(), updateUserIsChirpyRedParams)
-		if err != nil {
-			http.Error(w, "Failed to upgrade user", http.StatusInternalServerError)
+		_, err = processPolkaEvent(r.Context(), cfg, e)
+		if err != nil && !errors.Is(err, errDuplicateWebhook) {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "User not found", http.StatusNotFound)
+			} else {
+				http.Error(w, "Failed to update subscription", http.StatusInternalServerError)
+			}
 			return
 		}
 
@@ -0,0 +1,124 @@
+// Package loginthrottle decides how long a login must wait after failed
+// attempts. Failures are counted per key, such as an account or a client IP;
+// after a few free failures each one doubles the delay before the next
+// attempt, and enough of them lock the key for a while.
+package loginthrottle
+
+import "time"
+
+// Kinds of keys failures are counted against. Password reset requests are
+// counted under their own kinds, every request as a failure, so asking for
+// reset links doesn't lock anyone out of logging in.
+const (
+	KindAccount    = "account"
+	KindIP         = "ip"
+	KindResetEmail = "reset_email"
+	KindResetIP    = "reset_ip"
+)
+
+// Limits are the throttling rules for one kind of key.
+type Limits struct {
+	// FreeFailures is how many failures are allowed before any delay.
+	FreeFailures int
+	// BaseDelay is the delay after the first failure past FreeFailures.
+	// It doubles with each failure after that, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// MaxFailures locks the key for Lockout once it is reached. Every
+	// failure after that locks it again. Zero never locks.
+	MaxFailures int
+	Lockout     time.Duration
+	// Window is how long failures are remembered after the last one.
+	Window time.Duration
+}
+
+// State is what is remembered about a key's failures.
+type State struct {
+	Failures     int
+	LastFailedAt time.Time
+	LockedUntil  time.Time
+}
+
+// Default returns the limits for accounts and for client IPs. An account is
+// locked for 15 minutes after 10 failures. An IP is never locked, since many
+// users may share one, but is slowed down after 20.
+func Default() (account, ip Limits) {
+	account = Limits{
+		FreeFailures: 3,
+		BaseDelay:    time.Second,
+		MaxDelay:     time.Minute,
+		MaxFailures:  10,
+		Lockout:      15 * time.Minute,
+		Window:       time.Hour,
+	}
+	ip = Limits{
+		FreeFailures: 20,
+		BaseDelay:    time.Second,
+		MaxDelay:     time.Minute,
+		Window:       time.Hour,
+	}
+	return account, ip
+}
+
+// ResetDefault returns the limits for password reset requests per email and
+// per client IP. An email gets 3 requests before each one makes the next
+// wait, starting at a minute; an IP gets 10, starting at a second. Neither
+// is ever locked.
+func ResetDefault() (email, ip Limits) {
+	email = Limits{
+		FreeFailures: 3,
+		BaseDelay:    time.Minute,
+		MaxDelay:     15 * time.Minute,
+		Window:       time.Hour,
+	}
+	ip = Limits{
+		FreeFailures: 10,
+		BaseDelay:    time.Second,
+		MaxDelay:     time.Minute,
+		Window:       time.Hour,
+	}
+	return email, ip
+}
+
+// Delay returns how long to wait after the given number of failures.
+func (l Limits) Delay(failures int) time.Duration {
+	n := failures - l.FreeFailures
+	if n <= 0 || l.BaseDelay <= 0 {
+		return 0
+	}
+
+	d := l.BaseDelay
+	for i := 1; i < n && d < l.MaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, l.MaxDelay)
+}
+
+// Wait returns how long until a key in state s may try again, or zero if it
+// may try now.
+func (l Limits) Wait(s State, now time.Time) time.Duration {
+	wait := s.LockedUntil.Sub(now)
+	if !s.LastFailedAt.IsZero() {
+		wait = max(wait, s.LastFailedAt.Add(l.Delay(s.Failures)).Sub(now))
+	}
+	return max(wait, 0)
+}
+
+// Locked reports whether a key in state s is locked out at now.
+func (s State) Locked(now time.Time) bool {
+	return s.LockedUntil.After(now)
+}
+
+// Fail returns the state of a key after another failure at now.
+func (l Limits) Fail(s State, now time.Time) State {
+	if now.Sub(s.LastFailedAt) > l.Window {
+		s = State{}
+	}
+
+	s.Failures++
+	s.LastFailedAt = now
+	if l.MaxFailures > 0 && s.Failures >= l.MaxFailures {
+		s.LockedUntil = now.Add(l.Lockout)
+	}
+	return s
+}
@@ -0,0 +1,101 @@
+package loginthrottle
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDelay(t *testing.T) {
+	l := Limits{FreeFailures: 3, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	cases := []struct {
+		failures int
+		expect   time.Duration
+	}{
+		{0, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{6, 4 * time.Second},
+		{7, 8 * time.Second},
+		{8, 10 * time.Second},
+		{1000, 10 * time.Second},
+	}
+
+	for _, tc := range cases {
+		if got := l.Delay(tc.failures); got != tc.expect {
+			t.Errorf("Delay(%d): expected %v, got %v", tc.failures, tc.expect, got)
+		}
+	}
+}
+
+func TestFailAndWait(t *testing.T) {
+	l := Limits{
+		FreeFailures: 2,
+		BaseDelay:    time.Second,
+		MaxDelay:     time.Minute,
+		MaxFailures:  5,
+		Lockout:      15 * time.Minute,
+		Window:       time.Hour,
+	}
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	var s State
+	for i := 1; i <= 2; i++ {
+		s = l.Fail(s, now)
+		if wait := l.Wait(s, now); wait != 0 {
+			t.Fatalf("after %d failures: expected no wait, got %v", i, wait)
+		}
+	}
+
+	s = l.Fail(s, now)
+	if wait := l.Wait(s, now); wait != time.Second {
+		t.Fatalf("expected a 1s wait, got %v", wait)
+	}
+	if wait := l.Wait(s, now.Add(time.Second)); wait != 0 {
+		t.Fatalf("expected the delay to pass, got %v", wait)
+	}
+
+	s = l.Fail(s, now)
+	s = l.Fail(s, now)
+	if !s.Locked(now) {
+		t.Fatalf("expected a lockout after %d failures", s.Failures)
+	}
+	if wait := l.Wait(s, now); wait != 15*time.Minute {
+		t.Fatalf("expected a 15m wait, got %v", wait)
+	}
+
+	// A failure after the lockout ends, while the earlier ones are still
+	// remembered, locks the key again.
+	later := now.Add(20 * time.Minute)
+	if s.Locked(later) {
+		t.Fatalf("expected the lockout to end")
+	}
+	s = l.Fail(s, later)
+	if !s.Locked(later) || s.Failures != 6 {
+		t.Fatalf("expected another lockout, got %+v", s)
+	}
+
+	// Failures are forgotten a window after the last one.
+	muchLater := later.Add(l.Lockout + 2*time.Hour)
+	s = l.Fail(s, muchLater)
+	if s.Failures != 1 || s.Locked(muchLater) {
+		t.Fatalf("expected a fresh count, got %+v", s)
+	}
+}
+
+func TestNeverLocksWithoutMaxFailures(t *testing.T) {
+	_, ip := Default()
+	now := time.Now()
+
+	var s State
+	for range 1000 {
+		s = ip.Fail(s, now)
+	}
+	if s.Locked(now) {
+		t.Errorf("expected IPs never to be locked")
+	}
+	if wait := ip.Wait(s, now); wait != ip.MaxDelay {
+		t.Errorf("expected the maximum delay, got %v", wait)
+	}
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/karprabha/chirpy/internal/auth"
+	"github.com/karprabha/chirpy/internal/config"
+	"github.com/karprabha/chirpy/internal/policy"
+)
+
+// authRealm is the realm named in WWW-Authenticate challenges.
+const authRealm = "chirpy"
+
+// WithAuth requires a valid access token with scope before calling next, and
+// stores its claims in the request context for auth.FromContext. An empty
+// scope accepts any valid token. Failures get a 401 or 403 with an RFC 6750
+// WWW-Authenticate challenge.
+func WithAuth(cfg *config.Config, scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			challenge(w, http.StatusUnauthorized, "", "Unauthorized: Invalid or missing token")
+			return
+		}
+
+		claims, err := cfg.JWTKeys.Validate(token, auth.WithRevocationCheck(r.Context(), cfg.Revocations))
+		if err != nil {
+			challenge(w, http.StatusUnauthorized, `error="invalid_token"`, "Unauthorized: Invalid or expired token")
+			return
+		}
+
+		if scope != "" && !claims.HasScope(scope) {
+			challenge(w, http.StatusForbidden, `error="insufficient_scope", scope="`+scope+`"`, "Forbidden: token lacks the "+scope+" scope")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), claims)))
+	})
+}
+
+// WithOptionalAuth stores the claims of a valid access token in the request
+// context like WithAuth, but lets requests without one through anonymously.
+// Invalid tokens are treated as missing.
+func WithOptionalAuth(cfg *config.Config, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := auth.GetBearerToken(r.Header)
+		if err == nil {
+			claims, err := cfg.JWTKeys.Validate(token, auth.WithRevocationCheck(r.Context(), cfg.Revocations))
+			if err == nil {
+				r = r.WithContext(auth.NewContext(r.Context(), claims))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// WithPermission requires the role of the authenticated user to have
+// permission p. It must be wrapped in WithAuth.
+func WithPermission(p policy.Permission, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims := auth.FromContext(r.Context())
+		if claims == nil {
+			challenge(w, http.StatusUnauthorized, "", "Unauthorized: Invalid or missing token")
+			return
+		}
+		if !policy.Can(claims.Role, p) {
+			http.Error(w, "Forbidden: your role does not allow this", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func challenge(w http.ResponseWriter, code int, params, msg string) {
+	value := `Bearer realm="` + authRealm + `"`
+	if params != "" {
+		value += ", " + params
+	}
+	w.Header().Set("WWW-Authenticate", value)
+	http.Error(w, msg, code)
+}
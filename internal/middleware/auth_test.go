@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/karprabha/chirpy/internal/auth"
+	"github.com/karprabha/chirpy/internal/config"
+	"github.com/karprabha/chirpy/internal/policy"
+)
+
+func TestWithAuth(t *testing.T) {
+	cfg := &config.Config{JWTKeys: auth.NewHMACKeySet("mysecretkey")}
+	userID := uuid.New()
+
+	makeToken := func(scopes ...string) string {
+		t.Helper()
+		token, err := cfg.JWTKeys.MakeAccessToken(auth.Claims{UserID: userID, Scopes: scopes}, time.Hour)
+		if err != nil {
+			t.Fatalf("MakeAccessToken returned error: %v", err)
+		}
+		return token
+	}
+
+	cases := []struct {
+		name            string
+		authorization   string
+		optional        bool
+		expectStatus    int
+		expectChallenge string
+		expectUser      uuid.UUID
+	}{
+		{name: "valid token", authorization: "Bearer " + makeToken(auth.ScopeChirpsWrite), expectStatus: http.StatusOK, expectUser: userID},
+		{name: "missing token", expectStatus: http.StatusUnauthorized, expectChallenge: `Bearer realm="chirpy"`},
+		{name: "api key", authorization: "ApiKey abc", expectStatus: http.StatusUnauthorized, expectChallenge: `Bearer realm="chirpy"`},
+		{name: "invalid token", authorization: "Bearer nope", expectStatus: http.StatusUnauthorized, expectChallenge: `Bearer realm="chirpy", error="invalid_token"`},
+		{name: "missing scope", authorization: "Bearer " + makeToken(auth.ScopeAccount), expectStatus: http.StatusForbidden, expectChallenge: `Bearer realm="chirpy", error="insufficient_scope", scope="chirps:write"`},
+		{name: "optional with token", authorization: "Bearer " + makeToken(), optional: true, expectStatus: http.StatusOK, expectUser: userID},
+		{name: "optional without token", optional: true, expectStatus: http.StatusOK},
+		{name: "optional with invalid token", authorization: "Bearer nope", optional: true, expectStatus: http.StatusOK},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotUser uuid.UUID
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if claims := auth.FromContext(r.Context()); claims != nil {
+					gotUser = claims.UserID
+				}
+			})
+
+			var h http.Handler
+			if tc.optional {
+				h = WithOptionalAuth(cfg, next)
+			} else {
+				h = WithAuth(cfg, auth.ScopeChirpsWrite, next)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectStatus {
+				t.Errorf("expected status %d, got %d", tc.expectStatus, rec.Code)
+			}
+			if got := rec.Header().Get("WWW-Authenticate"); got != tc.expectChallenge {
+				t.Errorf("expected challenge %q, got %q", tc.expectChallenge, got)
+			}
+			if gotUser != tc.expectUser {
+				t.Errorf("expected user %v, got %v", tc.expectUser, gotUser)
+			}
+		})
+	}
+}
+
+func TestWithPermission(t *testing.T) {
+	cases := []struct {
+		name         string
+		claims       *auth.Claims
+		expectStatus int
+	}{
+		{name: "admin", claims: &auth.Claims{Role: auth.RoleAdmin}, expectStatus: http.StatusOK},
+		{name: "moderator", claims: &auth.Claims{Role: auth.RoleModerator}, expectStatus: http.StatusForbidden},
+		{name: "user", claims: &auth.Claims{Role: auth.RoleUser}, expectStatus: http.StatusForbidden},
+		{name: "anonymous", expectStatus: http.StatusUnauthorized},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := WithPermission(policy.ResetData, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			if tc.claims != nil {
+				req = req.WithContext(auth.NewContext(req.Context(), tc.claims))
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectStatus {
+				t.Errorf("expected status %d, got %d", tc.expectStatus, rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"io"
+	"net/http"
+
+	"github.com/karprabha/chirpy/internal/auth"
+	"github.com/karprabha/chirpy/internal/webhooksig"
+)
+
+// maxWebhookBodyBytes bounds how much of a webhook body is read for
+// signature verification.
+const maxWebhookBodyBytes = 1 << 20
+
+// WithAPIKey rejects requests whose "Authorization: ApiKey <key>" header does
+// not match key. An empty key rejects every request.
+func WithAPIKey(key string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiKey, err := auth.GetAPIKey(r.Header)
+		if err != nil || key == "" || subtle.ConstantTimeCompare([]byte(apiKey), []byte(key)) != 1 {
+			http.Error(w, "Invalid API key", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// WithWebhookSignature verifies the signature in header against the raw
+// request body before calling next. The body is restored so next can read it.
+func WithWebhookSignature(v *webhooksig.Verifier, header string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodyBytes))
+		if err != nil {
+			http.Error(w, "Unable to read request body", http.StatusBadRequest)
+			return
+		}
+
+		if err := v.Verify(r.Header.Get(header), body); err != nil {
+			http.Error(w, "Invalid webhook signature", http.StatusUnauthorized)
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(w, r)
+	})
+}
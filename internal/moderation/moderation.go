@@ -0,0 +1,62 @@
+package moderation
+
+import (
+	"strings"
+	"unicode"
+)
+
+type Mode string
+
+const (
+	// ModeMask replaces profane words with "****".
+	ModeMask Mode = "mask"
+	// ModeFlag leaves the body untouched and marks the chirp as sensitive.
+	ModeFlag Mode = "flag"
+)
+
+var profanity = map[string]bool{
+	"kerfuffle": true, "sharbert": true, "fornax": true,
+}
+
+// ParseMode returns the moderation mode for s, defaulting to ModeMask.
+func ParseMode(s string) Mode {
+	if Mode(s) == ModeFlag {
+		return ModeFlag
+	}
+	return ModeMask
+}
+
+// Apply runs the profanity filter over body. It returns the body to store and
+// whether the chirp must be flagged as sensitive. Masking replaces words in
+// place, so the whitespace between them, newlines included, is kept.
+func Apply(body string, mode Mode) (string, bool) {
+	original := body
+	var b strings.Builder
+	found := false
+	for len(body) > 0 {
+		end := strings.IndexFunc(body, unicode.IsSpace)
+		if end == -1 {
+			end = len(body)
+		}
+		word := body[:end]
+		if profanity[strings.ToLower(word)] {
+			word = "****"
+			found = true
+		}
+		b.WriteString(word)
+
+		body = body[end:]
+		space := strings.IndexFunc(body, func(r rune) bool { return !unicode.IsSpace(r) })
+		if space == -1 {
+			space = len(body)
+		}
+		b.WriteString(body[:space])
+		body = body[space:]
+	}
+
+	if mode == ModeFlag {
+		return original, found
+	}
+
+	return b.String(), false
+}
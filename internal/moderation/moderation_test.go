@@ -0,0 +1,55 @@
+package moderation
+
+import "testing"
+
+func TestParseMode(t *testing.T) {
+	cases := []struct {
+		name   string
+		input  string
+		expect Mode
+	}{
+		{name: "empty defaults to mask", input: "", expect: ModeMask},
+		{name: "mask", input: "mask", expect: ModeMask},
+		{name: "flag", input: "flag", expect: ModeFlag},
+		{name: "unknown defaults to mask", input: "block", expect: ModeMask},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ParseMode(tc.input); got != tc.expect {
+				t.Errorf("expected %q, got %q", tc.expect, got)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	cases := []struct {
+		name          string
+		body          string
+		mode          Mode
+		expect        string
+		expectFlagged bool
+	}{
+		{name: "clean", body: "hello world", mode: ModeMask, expect: "hello world"},
+		{name: "masks word", body: "what a kerfuffle today", mode: ModeMask, expect: "what a **** today"},
+		{name: "case insensitive", body: "Sharbert and FORNAX", mode: ModeMask, expect: "**** and ****"},
+		{name: "punctuation is part of the word", body: "kerfuffle!", mode: ModeMask, expect: "kerfuffle!"},
+		{name: "keeps newlines and tabs", body: "a\nkerfuffle\tb", mode: ModeMask, expect: "a\n****\tb"},
+		{name: "keeps repeated spaces", body: "a  kerfuffle   b", mode: ModeMask, expect: "a  ****   b"},
+		{name: "flag leaves body", body: "a\nkerfuffle\tb", mode: ModeFlag, expect: "a\nkerfuffle\tb", expectFlagged: true},
+		{name: "flag clean", body: "hello", mode: ModeFlag, expect: "hello"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, flagged := Apply(tc.body, tc.mode)
+			if got != tc.expect {
+				t.Errorf("expected %q, got %q", tc.expect, got)
+			}
+			if flagged != tc.expectFlagged {
+				t.Errorf("expected flagged %v, got %v", tc.expectFlagged, flagged)
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package outbound
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/karprabha/chirpy/internal/database"
+	"github.com/karprabha/chirpy/internal/webhooksig"
+)
+
+// Events that endpoints can subscribe to.
+const (
+	EventChirpCreated = "chirp.created"
+	EventChirpDeleted = "chirp.deleted"
+	EventUserUpgraded = "user.upgraded"
+)
+
+var Events = []string{EventChirpCreated, EventChirpDeleted, EventUserUpgraded}
+
+// Delivery statuses stored in webhook_deliveries.status.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// Headers set on every delivery.
+const (
+	SignatureHeader = "Chirpy-Signature"
+	EventHeader     = "Chirpy-Event"
+	DeliveryHeader  = "Chirpy-Delivery"
+)
+
+// Envelope is the JSON body posted to endpoints. ID is shared by all
+// deliveries of the same event so receivers can de-duplicate.
+type Envelope struct {
+	ID        uuid.UUID `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+func ValidEvent(event string) bool {
+	return slices.Contains(Events, event)
+}
+
+// MakeSecret returns a new random signing secret for an endpoint.
+func MakeSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Enqueue queues a delivery of the event to every enabled endpoint of userID
+// subscribed to eventType. Call it with the transaction that makes the change
+// so that deliveries are queued if and only if the change commits.
+func Enqueue(ctx context.Context, q *database.Queries, userID uuid.UUID, eventType string, data any) error {
+	endpoints, err := q.GetSubscribedWebhookEndpoints(ctx, database.GetSubscribedWebhookEndpointsParams{
+		UserID: userID,
+		Event:  eventType,
+	})
+	if err != nil || len(endpoints) == 0 {
+		return err
+	}
+
+	eventID := uuid.New()
+	payload, err := json.Marshal(Envelope{
+		ID:        eventID,
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, endpoint := range endpoints {
+		err := q.CreateWebhookDelivery(ctx, database.CreateWebhookDeliveryParams{
+			EndpointID: endpoint.ID,
+			EventID:    eventID,
+			EventType:  eventType,
+			Payload:    payload,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Send posts the delivery payload to the endpoint, signed with its secret.
+// It returns the response status code, and an error for transport failures
+// and non-2xx responses.
+func Send(ctx context.Context, client *http.Client, endpoint database.WebhookEndpoint, d database.WebhookDelivery, now time.Time) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.Url, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Chirpy-Webhooks/1.0")
+	req.Header.Set(EventHeader, d.EventType)
+	req.Header.Set(DeliveryHeader, d.ID.String())
+	req.Header.Set(SignatureHeader, webhooksig.Header(now, d.Payload, endpoint.Secret))
+
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
+
+// Backoff returns the delay before retrying after the given attempt,
+// doubling from base and capped at max.
+func Backoff(attempt int, base, max time.Duration) time.Duration {
+	d := base
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if d >= max {
+			return max
+		}
+	}
+	return min(d, max)
+}
+
+// Worker delivers queued webhooks. Several workers may run against the same
+// database: deliveries are claimed with SKIP LOCKED and leased until they are
+// retried, so each attempt is made by one worker only.
+type Worker struct {
+	Queries      *database.Queries
+	Client       *http.Client
+	BatchSize    int
+	MaxAttempts  int
+	DisableAfter int
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+	Lease        time.Duration
+}
+
+// defaultBatchSize is how many deliveries a worker claims at once.
+const defaultBatchSize = 20
+
+// NewWorker returns a worker with the default limits. allowPrivate lets it
+// deliver to loopback and private addresses; see NewClient.
+func NewWorker(q *database.Queries, allowPrivate bool) *Worker {
+	return &Worker{
+		Queries:      q,
+		Client:       NewClient(allowPrivate),
+		BatchSize:    defaultBatchSize,
+		MaxAttempts:  10,
+		DisableAfter: 10,
+		BaseBackoff:  30 * time.Second,
+		MaxBackoff:   6 * time.Hour,
+		// Long enough to send the whole batch even if every send times
+		// out, so no other worker reclaims a delivery still being sent.
+		Lease: defaultBatchSize*SendTimeout + time.Minute,
+	}
+}
+
+// RunOnce attempts every delivery that is due, up to BatchSize, and returns
+// how many were attempted. A delivery is only sent if the send can time out
+// before its lease ends; the rest are left for when the lease runs out, so
+// a slow batch can't overlap another worker's claim.
+func (w *Worker) RunOnce(ctx context.Context) (int, error) {
+	now := time.Now().UTC()
+	leaseEnd := now.Add(w.Lease)
+	deliveries, err := w.Queries.ClaimDueWebhookDeliveries(ctx, database.ClaimDueWebhookDeliveriesParams{
+		NextAttemptAt: leaseEnd,
+		Limit:         int32(w.BatchSize),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	attempted := 0
+	for _, d := range deliveries {
+		if time.Now().UTC().Add(w.Client.Timeout).After(leaseEnd) {
+			break
+		}
+		if err := w.deliver(ctx, d); err != nil {
+			return 0, err
+		}
+		attempted++
+	}
+	return attempted, nil
+}
+
+func (w *Worker) deliver(ctx context.Context, d database.WebhookDelivery) error {
+	endpoint, err := w.Queries.GetWebhookEndpoint(ctx, d.EndpointID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	status, sendErr := Send(ctx, w.Client, endpoint, d, now)
+	responseStatus := sql.NullInt32{Int32: int32(status), Valid: status != 0}
+
+	if sendErr == nil {
+		if err := w.Queries.MarkWebhookDeliverySucceeded(ctx, database.MarkWebhookDeliverySucceededParams{
+			ID:             d.ID,
+			ResponseStatus: responseStatus,
+		}); err != nil {
+			return err
+		}
+		return w.Queries.ResetWebhookEndpointFailures(ctx, endpoint.ID)
+	}
+
+	failures, err := w.Queries.RecordWebhookEndpointFailure(ctx, endpoint.ID)
+	if err != nil {
+		return err
+	}
+	if int(failures) >= w.DisableAfter {
+		if err := w.Queries.DisableWebhookEndpoint(ctx, endpoint.ID); err != nil {
+			return err
+		}
+		log.Printf("Disabled webhook endpoint %s after %d consecutive failures", endpoint.ID, failures)
+	}
+
+	deliveryStatus := StatusPending
+	if int(d.Attempts) >= w.MaxAttempts {
+		deliveryStatus = StatusFailed
+	}
+
+	return w.Queries.MarkWebhookDeliveryFailed(ctx, database.MarkWebhookDeliveryFailedParams{
+		ID:             d.ID,
+		Status:         deliveryStatus,
+		NextAttemptAt:  now.Add(Backoff(int(d.Attempts), w.BaseBackoff, w.MaxBackoff)),
+		ResponseStatus: responseStatus,
+		Error:          sql.NullString{String: sendErr.Error(), Valid: true},
+	})
+}
+
+// Run calls RunOnce every interval until ctx is cancelled.
+func (w *Worker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := w.RunOnce(ctx); err != nil {
+				log.Printf("Failed to deliver webhooks: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package outbound
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/karprabha/chirpy/internal/database"
+	"github.com/karprabha/chirpy/internal/webhooksig"
+)
+
+func TestSend(t *testing.T) {
+	cases := []struct {
+		name         string
+		status       int
+		expectError  bool
+		expectStatus int
+	}{
+		{name: "accepted", status: http.StatusNoContent, expectStatus: http.StatusNoContent},
+		{name: "server error", status: http.StatusInternalServerError, expectError: true, expectStatus: http.StatusInternalServerError},
+		{name: "non 2xx status", status: http.StatusNotModified, expectError: true, expectStatus: http.StatusNotModified},
+	}
+
+	now := time.Now().UTC()
+	payload, err := json.Marshal(Envelope{ID: uuid.New(), Type: EventChirpCreated, CreatedAt: now, Data: map[string]string{"body": "hello"}})
+	if err != nil {
+		t.Fatalf("failed to marshal payload: %v", err)
+	}
+	delivery := database.WebhookDelivery{ID: uuid.New(), EventType: EventChirpCreated, Payload: payload}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var verifyErr error
+			var gotEvent, gotDelivery string
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				verifyErr = webhooksig.NewVerifier([]string{"secret"}).Verify(r.Header.Get(SignatureHeader), body)
+				gotEvent = r.Header.Get(EventHeader)
+				gotDelivery = r.Header.Get(DeliveryHeader)
+				w.WriteHeader(tc.status)
+			}))
+			defer receiver.Close()
+
+			endpoint := database.WebhookEndpoint{ID: uuid.New(), Url: receiver.URL, Secret: "secret"}
+			status, err := Send(context.Background(), receiver.Client(), endpoint, delivery, now)
+
+			if tc.expectError && err == nil {
+				t.Errorf("expected error but got none")
+			}
+			if !tc.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if status != tc.expectStatus {
+				t.Errorf("expected status %d, got %d", tc.expectStatus, status)
+			}
+			if verifyErr != nil {
+				t.Errorf("receiver could not verify signature: %v", verifyErr)
+			}
+			if gotEvent != EventChirpCreated {
+				t.Errorf("expected event header %q, got %q", EventChirpCreated, gotEvent)
+			}
+			if gotDelivery != delivery.ID.String() {
+				t.Errorf("expected delivery header %q, got %q", delivery.ID, gotDelivery)
+			}
+		})
+	}
+}
+
+func TestSendUnreachable(t *testing.T) {
+	receiver := httptest.NewServer(http.NotFoundHandler())
+	url := receiver.URL
+	receiver.Close()
+
+	endpoint := database.WebhookEndpoint{Url: url, Secret: "secret"}
+	status, err := Send(context.Background(), http.DefaultClient, endpoint, database.WebhookDelivery{Payload: []byte(`{}`)}, time.Now())
+	if err == nil {
+		t.Errorf("expected error but got none")
+	}
+	if status != 0 {
+		t.Errorf("expected no status, got %d", status)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	cases := []struct {
+		attempt int
+		expect  time.Duration
+	}{
+		{attempt: 1, expect: 30 * time.Second},
+		{attempt: 2, expect: time.Minute},
+		{attempt: 3, expect: 2 * time.Minute},
+		{attempt: 6, expect: 16 * time.Minute},
+		{attempt: 12, expect: time.Hour},
+		{attempt: 100, expect: time.Hour},
+	}
+
+	for _, tc := range cases {
+		if got := Backoff(tc.attempt, 30*time.Second, time.Hour); got != tc.expect {
+			t.Errorf("attempt %d: expected %v, got %v", tc.attempt, tc.expect, got)
+		}
+	}
+}
+
+func TestWorkerLeaseOutlastsBatch(t *testing.T) {
+	for _, allowPrivate := range []bool{false, true} {
+		w := NewWorker(nil, allowPrivate)
+		if batch := time.Duration(w.BatchSize) * w.Client.Timeout; w.Lease <= batch {
+			t.Errorf("lease %v doesn't outlast a batch of %d sends timing out after %v", w.Lease, w.BatchSize, w.Client.Timeout)
+		}
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	cases := []struct {
+		url          string
+		allowPrivate bool
+		expectError  bool
+	}{
+		{url: "https://93.184.216.34/hook"},
+		{url: "http://[2606:4700::1111]/hook"},
+		{url: "ftp://93.184.216.34/hook", expectError: true},
+		{url: "/relative", expectError: true},
+		{url: "http://127.0.0.1:8080/hook", expectError: true},
+		{url: "http://localhost/hook", expectError: true},
+		{url: "http://[::1]/hook", expectError: true},
+		{url: "http://[::ffff:127.0.0.1]/hook", expectError: true},
+		{url: "http://10.0.0.5/hook", expectError: true},
+		{url: "http://172.16.0.1/hook", expectError: true},
+		{url: "http://192.168.1.1/hook", expectError: true},
+		{url: "http://169.254.169.254/latest/meta-data", expectError: true},
+		{url: "http://[fe80::1]/hook", expectError: true},
+		{url: "http://224.0.0.1/hook", expectError: true},
+		{url: "http://0.0.0.0/hook", expectError: true},
+		{url: "http://100.64.0.1/hook", expectError: true},
+		{url: "http://100.127.255.254/hook", expectError: true},
+		{url: "http://100.128.0.1/hook"},
+		{url: "http://198.18.0.1/hook", expectError: true},
+		{url: "http://198.19.255.254/hook", expectError: true},
+		{url: "http://198.20.0.1/hook"},
+		{url: "http://127.0.0.1:8080/hook", allowPrivate: true},
+	}
+
+	for _, tc := range cases {
+		err := CheckURL(context.Background(), tc.url, tc.allowPrivate)
+		if (err != nil) != tc.expectError {
+			t.Errorf("CheckURL(%q, %v): expected error %v, got %v", tc.url, tc.allowPrivate, tc.expectError, err)
+		}
+	}
+}
+
+func TestClientRefusesPrivateTargets(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	endpoint := database.WebhookEndpoint{Url: receiver.URL, Secret: "secret"}
+	delivery := database.WebhookDelivery{Payload: []byte(`{}`)}
+
+	if _, err := Send(context.Background(), NewClient(false), endpoint, delivery, time.Now()); !errors.Is(err, ErrForbiddenTarget) {
+		t.Errorf("expected %v, got %v", ErrForbiddenTarget, err)
+	}
+
+	status, err := Send(context.Background(), NewClient(true), endpoint, delivery, time.Now())
+	if err != nil || status != http.StatusNoContent {
+		t.Errorf("expected delivery when private targets are allowed, got %d %v", status, err)
+	}
+}
+
+func TestClientDoesNotFollowRedirects(t *testing.T) {
+	var followed bool
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		followed = true
+	}))
+	defer target.Close()
+
+	receiver := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+	defer receiver.Close()
+
+	endpoint := database.WebhookEndpoint{Url: receiver.URL, Secret: "secret"}
+	status, err := Send(context.Background(), NewClient(true), endpoint, database.WebhookDelivery{Payload: []byte(`{}`)}, time.Now())
+	if err == nil || status != http.StatusTemporaryRedirect {
+		t.Errorf("expected the redirect to fail the delivery, got %d %v", status, err)
+	}
+	if followed {
+		t.Errorf("expected the redirect not to be followed")
+	}
+}
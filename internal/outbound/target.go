@@ -0,0 +1,113 @@
+package outbound
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenTarget is returned for webhook URLs and connections that would
+// reach the server's own network rather than the internet.
+var ErrForbiddenTarget = errors.New("webhook target address is not allowed")
+
+// SendTimeout bounds a single delivery, from dialing to reading the
+// response.
+const SendTimeout = 10 * time.Second
+
+var (
+	// thisNetwork is 0.0.0.0/8, which Linux routes to the local host.
+	thisNetwork = netip.MustParsePrefix("0.0.0.0/8")
+	// sharedAddressSpace is 100.64.0.0/10, used for carrier-grade NAT and by
+	// some cloud providers for internal services.
+	sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+	// benchmarkingNetwork is 198.18.0.0/15, reserved for network tests.
+	benchmarkingNetwork = netip.MustParsePrefix("198.18.0.0/15")
+)
+
+// ForbiddenAddr reports whether webhooks may not be sent to addr: loopback,
+// private, shared (CGNAT), benchmarking, link-local, multicast and
+// unspecified addresses.
+func ForbiddenAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return !addr.IsValid() ||
+		addr.IsLoopback() ||
+		addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() ||
+		addr.IsUnspecified() ||
+		thisNetwork.Contains(addr) ||
+		sharedAddressSpace.Contains(addr) ||
+		benchmarkingNetwork.Contains(addr)
+}
+
+// CheckURL reports whether rawURL may be registered as an endpoint: it must
+// be an absolute http or https URL, and unless allowPrivate is set, its host
+// must only resolve to addresses that aren't forbidden.
+func CheckURL(ctx context.Context, rawURL string, allowPrivate bool) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	if allowPrivate {
+		return nil
+	}
+
+	host := u.Hostname()
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if ForbiddenAddr(addr) {
+			return ErrForbiddenTarget
+		}
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("url host could not be resolved: %w", err)
+	}
+	for _, addr := range addrs {
+		if ForbiddenAddr(addr) {
+			return ErrForbiddenTarget
+		}
+	}
+	return nil
+}
+
+// NewClient returns the HTTP client deliveries are sent with. It never
+// follows redirects, so a public URL can't bounce a delivery elsewhere.
+// Unless allowPrivate is set, it refuses to connect to forbidden addresses;
+// the check is made on the address actually dialed, so a host that resolves
+// differently after registration still can't reach them.
+func NewClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: SendTimeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil || ForbiddenAddr(addrPort.Addr()) {
+				return ErrForbiddenTarget
+			}
+			return nil
+		}
+	}
+
+	return &http.Client{
+		Timeout: SendTimeout,
+		Transport: &http.Transport{
+			// No proxy: the dialer must see the real target.
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
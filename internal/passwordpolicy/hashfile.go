@@ -0,0 +1,150 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// HashFile is a BreachedList read from a local file of SHA-1 hashes, one per
+// line and sorted, each optionally followed by ":" and a count, as in the
+// Pwned Passwords download ordered by hash. The file can be far bigger than
+// memory: Range finds a prefix with a binary search and reads only the lines
+// that match.
+type HashFile struct {
+	f    *os.File
+	size int64
+}
+
+// OpenHashFile opens the hash list at path.
+func OpenHashFile(path string) (*HashFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &HashFile{f: f, size: info.Size()}, nil
+}
+
+func (h *HashFile) Close() error {
+	return h.f.Close()
+}
+
+func (h *HashFile) Range(ctx context.Context, prefix string) (map[string]int, error) {
+	prefix = strings.ToUpper(prefix)
+
+	// Find the first line at or after an offset whose hash doesn't sort
+	// before prefix. Lines are found by the offset they're read from, which
+	// is monotonic: a later offset never yields an earlier line.
+	lo, hi := int64(0), h.size
+	for lo < hi {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		mid := lo + (hi-lo)/2
+		line, err := h.lineAfter(mid)
+		if err != nil {
+			return nil, err
+		}
+		if line == "" || line[:min(len(line), len(prefix))] >= prefix {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+
+	r, err := h.reader(lo)
+	if err != nil {
+		return nil, err
+	}
+
+	suffixes := make(map[string]int)
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, prefix) {
+			return suffixes, nil
+		}
+
+		hash, count, err := parseLine(line)
+		if err != nil {
+			return nil, err
+		}
+		suffixes[hash[len(prefix):]] += count
+	}
+}
+
+// lineAfter returns the first whole line starting at or after off, in upper
+// case, or "" at the end of the file.
+func (h *HashFile) lineAfter(off int64) (string, error) {
+	r, err := h.reader(off)
+	if err != nil {
+		return "", err
+	}
+	return readLine(r)
+}
+
+// reader reads from the first line starting at or after off.
+func (h *HashFile) reader(off int64) (*bufio.Reader, error) {
+	if off == 0 {
+		return bufio.NewReader(io.NewSectionReader(h.f, 0, h.size)), nil
+	}
+
+	// Back up a byte so a line starting exactly at off isn't skipped.
+	r := bufio.NewReader(io.NewSectionReader(h.f, off-1, h.size-off+1))
+	if _, err := r.ReadString('\n'); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return r, nil
+}
+
+// readLine returns the next line without its line ending, in upper case, or
+// "" at the end of the file. Blank lines are skipped.
+func readLine(r *bufio.Reader) (string, error) {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", err
+		}
+
+		line = strings.TrimSpace(line)
+		if line != "" {
+			return strings.ToUpper(line), nil
+		}
+		if err != nil {
+			return "", nil
+		}
+	}
+}
+
+// parseLine splits a line into its hash and count. A line without a count
+// counts once.
+func parseLine(line string) (string, int, error) {
+	hash, countStr, hasCount := strings.Cut(line, ":")
+	if len(hash) != 40 {
+		return "", 0, fmt.Errorf("invalid hash %q", hash)
+	}
+	if !hasCount {
+		return hash, 1, nil
+	}
+
+	count, err := strconv.Atoi(countStr)
+	if err != nil || count < 1 {
+		return "", 0, fmt.Errorf("invalid count for hash %s", hash)
+	}
+	return hash, count, nil
+}
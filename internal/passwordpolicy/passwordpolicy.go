@@ -0,0 +1,112 @@
+package passwordpolicy
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxBytes is the longest password bcrypt accepts. Longer passwords are
+// rejected rather than silently truncated.
+const MaxBytes = 72
+
+// DefaultMinLength is the minimum length in characters when none is
+// configured.
+const DefaultMinLength = 8
+
+// Rules a password can violate.
+const (
+	RuleMinLength   = "min_length"
+	RuleMaxLength   = "max_length"
+	RuleNotEmail    = "not_email"
+	RuleNotBreached = "not_breached"
+)
+
+// Violation is a rule a password breaks, with a message for the user.
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Policy decides whether a password may be set. Breached is optional; when
+// it is nil, passwords aren't checked against known breaches.
+type Policy struct {
+	MinLength int
+	Breached  BreachedList
+}
+
+// Check returns every rule password breaks for the account with email, or
+// none if it is acceptable. An error means the breach list couldn't be read.
+func (p *Policy) Check(ctx context.Context, password, email string) ([]Violation, error) {
+	var violations []Violation
+
+	if n := utf8.RuneCountInString(password); n < p.MinLength {
+		violations = append(violations, Violation{
+			Rule:    RuleMinLength,
+			Message: fmt.Sprintf("Password must be at least %d characters", p.MinLength),
+		})
+	}
+
+	if len(password) > MaxBytes {
+		violations = append(violations, Violation{
+			Rule:    RuleMaxLength,
+			Message: fmt.Sprintf("Password must be at most %d bytes", MaxBytes),
+		})
+	}
+
+	if isEmail(password, email) {
+		violations = append(violations, Violation{
+			Rule:    RuleNotEmail,
+			Message: "Password must not be your email address",
+		})
+	}
+
+	if p.Breached != nil {
+		breached, err := IsBreached(ctx, p.Breached, password)
+		if err != nil {
+			return nil, err
+		}
+		if breached {
+			violations = append(violations, Violation{
+				Rule:    RuleNotBreached,
+				Message: "Password has appeared in a data breach",
+			})
+		}
+	}
+
+	return violations, nil
+}
+
+// isEmail reports whether password is email, or the part of it before the
+// @, ignoring case.
+func isEmail(password, email string) bool {
+	if email == "" {
+		return false
+	}
+	local, _, _ := strings.Cut(email, "@")
+	return strings.EqualFold(password, email) || (local != "" && strings.EqualFold(password, local))
+}
+
+// BreachedList finds the SHA-1 hashes of breached passwords that start with
+// a five character hex prefix, like the Pwned Passwords range API. Asking by
+// prefix means a list served by someone else never sees the full hash.
+type BreachedList interface {
+	// Range returns the remaining 35 characters of every hash starting
+	// with prefix, in upper case, mapped to how often it was seen.
+	Range(ctx context.Context, prefix string) (map[string]int, error)
+}
+
+// IsBreached reports whether password is in list.
+func IsBreached(ctx context.Context, list BreachedList, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes, err := list.Range(ctx, hash[:5])
+	if err != nil {
+		return false, err
+	}
+	return suffixes[hash[5:]] > 0, nil
+}
@@ -0,0 +1,168 @@
+package passwordpolicy
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// writeHashFile writes a sorted hash list of the given passwords, padded
+// with filler hashes so the binary search has work to do.
+func writeHashFile(t *testing.T, passwords ...string) string {
+	t.Helper()
+
+	var lines []string
+	for _, pw := range passwords {
+		lines = append(lines, sha1Hex(pw)+":3")
+	}
+	for i := range 500 {
+		lines = append(lines, sha1Hex(fmt.Sprintf("filler-%d", i))+":1")
+	}
+	sort.Strings(lines)
+
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\r\n")+"\r\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func rules(violations []Violation) []string {
+	var r []string
+	for _, v := range violations {
+		r = append(r, v.Rule)
+	}
+	return r
+}
+
+func TestCheck(t *testing.T) {
+	hf, err := OpenHashFile(writeHashFile(t, "password123", "correcthorse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hf.Close()
+
+	p := &Policy{MinLength: 8, Breached: hf}
+
+	tests := []struct {
+		name     string
+		password string
+		email    string
+		want     []string
+	}{
+		{"acceptable", "tr0ub4dor&3-staple", "walt@example.com", nil},
+		{"too short", "a", "walt@example.com", []string{RuleMinLength}},
+		{"counts characters not bytes", "ééééééé", "walt@example.com", []string{RuleMinLength}},
+		{"too long", strings.Repeat("x", MaxBytes+1), "walt@example.com", []string{RuleMaxLength}},
+		{"exactly max", strings.Repeat("x", MaxBytes), "walt@example.com", nil},
+		{"email", "Walt@Example.com", "walt@example.com", []string{RuleNotEmail}},
+		{"email local part", "WALTWHITE", "waltwhite@example.com", []string{RuleNotEmail}},
+		{"breached", "password123", "walt@example.com", []string{RuleNotBreached}},
+		{"every rule", "walt", "walt@example.com", []string{RuleMinLength, RuleNotEmail}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations, err := p.Check(context.Background(), tt.password, tt.email)
+			if err != nil {
+				t.Fatalf("Check returned error: %v", err)
+			}
+			if got := rules(violations); !slices.Equal(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCheckWithoutBreachedList(t *testing.T) {
+	violations, err := (&Policy{MinLength: 8}).Check(context.Background(), "password123", "walt@example.com")
+	if err != nil {
+		t.Fatalf("Check returned error: %v", err)
+	}
+	if len(violations) != 0 {
+		t.Errorf("expected no violations, got %v", violations)
+	}
+}
+
+func TestHashFileRange(t *testing.T) {
+	path := writeHashFile(t, "password123", "correcthorse")
+	hf, err := OpenHashFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hf.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every hash in the file, including the first and last, is found by
+	// its prefix, and nothing else is returned with it.
+	for _, line := range strings.Fields(string(data)) {
+		hash, _, _ := strings.Cut(line, ":")
+		suffixes, err := hf.Range(context.Background(), strings.ToLower(hash[:5]))
+		if err != nil {
+			t.Fatalf("Range returned error: %v", err)
+		}
+		if suffixes[hash[5:]] == 0 {
+			t.Fatalf("expected %s to be found", hash)
+		}
+		for suffix := range suffixes {
+			if !strings.Contains(string(data), hash[:5]+suffix) {
+				t.Errorf("unexpected suffix %s for prefix %s", suffix, hash[:5])
+			}
+		}
+	}
+
+	for _, prefix := range []string{"00000", "FFFFF"} {
+		suffixes, err := hf.Range(context.Background(), prefix)
+		if err != nil {
+			t.Fatalf("Range returned error: %v", err)
+		}
+		for suffix := range suffixes {
+			if !strings.Contains(string(data), prefix+suffix) {
+				t.Errorf("unexpected suffix %s for prefix %s", suffix, prefix)
+			}
+		}
+	}
+
+	breached, err := IsBreached(context.Background(), hf, "correcthorse")
+	if err != nil || !breached {
+		t.Errorf("expected correcthorse to be breached, got %v %v", breached, err)
+	}
+	breached, err = IsBreached(context.Background(), hf, "correcthorsebatterystaple")
+	if err != nil || breached {
+		t.Errorf("expected correcthorsebatterystaple not to be breached, got %v %v", breached, err)
+	}
+}
+
+func TestHashFileRejectsMalformedLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	hash := sha1Hex("password123")
+	if err := os.WriteFile(path, []byte(hash+":many\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	hf, err := OpenHashFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hf.Close()
+
+	if _, err := hf.Range(context.Background(), hash[:5]); err == nil {
+		t.Errorf("expected a malformed count to be an error")
+	}
+}
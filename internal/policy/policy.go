@@ -0,0 +1,66 @@
+// Package policy defines what each user role is allowed to do. Routes check
+// permissions, never roles, so changing what a role may do only takes an
+// edit here.
+package policy
+
+import (
+	"slices"
+
+	"github.com/karprabha/chirpy/internal/auth"
+)
+
+// Permission is an action that not every user may take.
+type Permission string
+
+const (
+	ViewMetrics         Permission = "metrics:view"
+	ResetData           Permission = "data:reset"
+	ViewWebhookEvents   Permission = "webhook_events:view"
+	ReplayWebhookEvents Permission = "webhook_events:replay"
+	ManageRoles         Permission = "roles:manage"
+	ViewLockouts        Permission = "lockouts:view"
+	ManageLockouts      Permission = "lockouts:manage"
+	ViewSubscriptions   Permission = "subscriptions:view"
+)
+
+var rolePermissions = map[string][]Permission{
+	auth.RoleUser: {},
+	auth.RoleModerator: {
+		ViewMetrics,
+		ViewWebhookEvents,
+		ViewLockouts,
+		ViewSubscriptions,
+	},
+	auth.RoleAdmin: {
+		ViewMetrics,
+		ResetData,
+		ViewWebhookEvents,
+		ReplayWebhookEvents,
+		ManageRoles,
+		ViewLockouts,
+		ManageLockouts,
+		ViewSubscriptions,
+	},
+}
+
+// ValidRole reports whether role is a known role.
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// Can reports whether role has permission p. Unknown roles have none.
+func Can(role string, p Permission) bool {
+	return slices.Contains(rolePermissions[role], p)
+}
+
+// Scopes returns the scopes of access tokens issued to a user with role.
+// Roles with any permission also get the admin scope, which every admin
+// route requires.
+func Scopes(role string) []string {
+	scopes := slices.Clone(auth.DefaultScopes)
+	if len(rolePermissions[role]) > 0 {
+		scopes = append(scopes, auth.ScopeAdmin)
+	}
+	return scopes
+}
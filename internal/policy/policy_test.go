@@ -0,0 +1,59 @@
+package policy
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/karprabha/chirpy/internal/auth"
+)
+
+func TestCan(t *testing.T) {
+	cases := []struct {
+		role   string
+		perm   Permission
+		expect bool
+	}{
+		{role: auth.RoleAdmin, perm: ResetData, expect: true},
+		{role: auth.RoleAdmin, perm: ManageRoles, expect: true},
+		{role: auth.RoleModerator, perm: ViewMetrics, expect: true},
+		{role: auth.RoleModerator, perm: ViewWebhookEvents, expect: true},
+		{role: auth.RoleModerator, perm: ReplayWebhookEvents, expect: false},
+		{role: auth.RoleModerator, perm: ManageRoles, expect: false},
+		{role: auth.RoleModerator, perm: ViewLockouts, expect: true},
+		{role: auth.RoleModerator, perm: ManageLockouts, expect: false},
+		{role: auth.RoleAdmin, perm: ManageLockouts, expect: true},
+		{role: auth.RoleModerator, perm: ViewSubscriptions, expect: true},
+		{role: auth.RoleUser, perm: ViewSubscriptions, expect: false},
+		{role: auth.RoleUser, perm: ViewMetrics, expect: false},
+		{role: "", perm: ViewMetrics, expect: false},
+		{role: "superuser", perm: ViewMetrics, expect: false},
+	}
+
+	for _, tc := range cases {
+		if got := Can(tc.role, tc.perm); got != tc.expect {
+			t.Errorf("Can(%q, %q): expected %v, got %v", tc.role, tc.perm, tc.expect, got)
+		}
+	}
+}
+
+func TestScopes(t *testing.T) {
+	cases := []struct {
+		role        string
+		expectAdmin bool
+	}{
+		{role: auth.RoleUser, expectAdmin: false},
+		{role: auth.RoleModerator, expectAdmin: true},
+		{role: auth.RoleAdmin, expectAdmin: true},
+		{role: "superuser", expectAdmin: false},
+	}
+
+	for _, tc := range cases {
+		scopes := Scopes(tc.role)
+		if got := slices.Contains(scopes, auth.ScopeAdmin); got != tc.expectAdmin {
+			t.Errorf("Scopes(%q): expected admin scope %v, got %v", tc.role, tc.expectAdmin, got)
+		}
+		if !slices.Contains(scopes, auth.ScopeChirpsWrite) {
+			t.Errorf("Scopes(%q): expected %s", tc.role, auth.ScopeChirpsWrite)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package subscription
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/karprabha/chirpy/internal/database"
+)
+
+const (
+	EventUpgraded   = "user.upgraded"
+	EventDowngraded = "user.downgraded"
+	EventCancelled  = "subscription.cancelled"
+	EventRenewed    = "subscription.renewed"
+	EventExpired    = "subscription.expired"
+)
+
+var (
+	ErrUnknownEvent = errors.New("unknown subscription event")
+	ErrStaleEvent   = errors.New("subscription event is older than the last applied event")
+)
+
+// Event is a change to a user's Chirpy Red subscription reported by the
+// payment provider. ExpiresAt is optional; when it is missing the end of the
+// paid period is derived from the configured subscription period. OccurredAt
+// is when the provider emitted the event and is used to drop events that
+// arrive out of order.
+type Event struct {
+	Type       string
+	UserID     uuid.UUID
+	ExpiresAt  *time.Time
+	OccurredAt time.Time
+}
+
+// Handles reports whether eventType changes subscription state.
+func Handles(eventType string) bool {
+	switch eventType {
+	case EventUpgraded, EventDowngraded, EventCancelled, EventRenewed:
+		return true
+	}
+	return false
+}
+
+// Apply updates the user's subscription for e and records it in the
+// subscription history. q should be bound to a transaction: the user row is
+// locked so concurrent events for the same user are applied one at a time.
+// It returns sql.ErrNoRows if the user does not exist and ErrStaleEvent if a
+// more recent event has already been applied.
+func Apply(ctx context.Context, q *database.Queries, e Event, period time.Duration) (database.User, error) {
+	if !Handles(e.Type) {
+		return database.User{}, ErrUnknownEvent
+	}
+
+	user, err := q.GetUserByIDForUpdate(ctx, e.UserID)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	occurredAt := e.OccurredAt.UTC()
+	if user.SubscriptionEventAt.Valid && occurredAt.Before(user.SubscriptionEventAt.Time) {
+		return database.User{}, ErrStaleEvent
+	}
+
+	isRed, expiresAt, err := transition(user, e, time.Now().UTC(), period)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	return update(ctx, q, user, e.Type, isRed, expiresAt, validTime(occurredAt))
+}
+
+// errNotLapsed is returned by transition for an expiry of a subscription
+// that is still paid for.
+var errNotLapsed = errors.New("subscription has not lapsed")
+
+// transition returns the subscription user has after e at now. Expiry
+// events are only valid once the paid period has ended.
+func transition(user database.User, e Event, now time.Time, period time.Duration) (bool, sql.NullTime, error) {
+	switch e.Type {
+	case EventUpgraded:
+		return true, validTime(orDefault(e.ExpiresAt, now.Add(period))), nil
+	case EventRenewed:
+		// Renewals extend the current period rather than restarting it, so
+		// an early renewal doesn't cost the user the days they paid for.
+		start := now
+		if user.RedExpiresAt.Valid && user.RedExpiresAt.Time.After(now) {
+			start = user.RedExpiresAt.Time
+		}
+		return true, validTime(orDefault(e.ExpiresAt, start.Add(period))), nil
+	case EventCancelled:
+		// Cancelled subscriptions stay active until the end of the paid
+		// period, then the expiry job downgrades them.
+		end := now
+		if user.RedExpiresAt.Valid {
+			end = user.RedExpiresAt.Time
+		}
+		return user.IsChirpyRed, validTime(orDefault(e.ExpiresAt, end)), nil
+	case EventDowngraded:
+		return false, sql.NullTime{}, nil
+	case EventExpired:
+		// The expiry stays recorded so the history shows when it lapsed.
+		if !user.IsChirpyRed || !user.RedExpiresAt.Valid || user.RedExpiresAt.Time.After(now) {
+			return user.IsChirpyRed, user.RedExpiresAt, errNotLapsed
+		}
+		return false, user.RedExpiresAt, nil
+	}
+	return user.IsChirpyRed, user.RedExpiresAt, ErrUnknownEvent
+}
+
+// update stores the user's new subscription and records it in the
+// subscription history under event.
+func update(ctx context.Context, q *database.Queries, user database.User, event string, isRed bool, expiresAt, eventAt sql.NullTime) (database.User, error) {
+	user, err := q.UpdateUserSubscription(ctx, database.UpdateUserSubscriptionParams{
+		ID:                  user.ID,
+		IsChirpyRed:         isRed,
+		RedExpiresAt:        expiresAt,
+		SubscriptionEventAt: eventAt,
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+
+	_, err = q.CreateSubscriptionHistory(ctx, database.CreateSubscriptionHistoryParams{
+		UserID:       user.ID,
+		Event:        event,
+		IsChirpyRed:  user.IsChirpyRed,
+		RedExpiresAt: user.RedExpiresAt,
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+
+	return user, nil
+}
+
+// ExpireLapsed downgrades every user whose paid period has ended and returns
+// how many were downgraded.
+func ExpireLapsed(ctx context.Context, db *sql.DB, q *database.Queries) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	qtx := q.WithTx(tx)
+
+	users, err := qtx.ListLapsedSubscriptionsForUpdate(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now().UTC()
+	n := 0
+	for _, user := range users {
+		isRed, expiresAt, err := transition(user, Event{Type: EventExpired, UserID: user.ID}, now, 0)
+		if errors.Is(err, errNotLapsed) {
+			// The database clock is ahead of ours; the next run gets it.
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		// Expiry isn't a provider event, so the last event time stays.
+		if _, err := update(ctx, qtx, user, EventExpired, isRed, expiresAt, user.SubscriptionEventAt); err != nil {
+			return 0, err
+		}
+		n++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// RunExpiry calls ExpireLapsed every interval until ctx is cancelled.
+func RunExpiry(ctx context.Context, db *sql.DB, q *database.Queries, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := ExpireLapsed(ctx, db, q)
+			if err != nil {
+				log.Printf("Failed to expire lapsed subscriptions: %v", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("Expired %d lapsed Chirpy Red subscriptions", n)
+			}
+		}
+	}
+}
+
+func orDefault(t *time.Time, def time.Time) time.Time {
+	if t == nil {
+		return def
+	}
+	return t.UTC()
+}
+
+func validTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: true}
+}
@@ -0,0 +1,125 @@
+package subscription
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/karprabha/chirpy/internal/database"
+)
+
+func TestTransition(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	period := 30 * 24 * time.Hour
+	inTenDays := now.Add(10 * 24 * time.Hour)
+	tenDaysAgo := now.Add(-10 * 24 * time.Hour)
+	explicit := now.Add(90 * 24 * time.Hour)
+
+	free := database.User{}
+	red := func(expiresAt time.Time) database.User {
+		return database.User{IsChirpyRed: true, RedExpiresAt: validTime(expiresAt)}
+	}
+
+	cases := []struct {
+		name          string
+		user          database.User
+		event         Event
+		expectRed     bool
+		expectExpires sql.NullTime
+		expectErr     error
+	}{
+		{
+			name:          "upgrade starts a period now",
+			user:          free,
+			event:         Event{Type: EventUpgraded},
+			expectRed:     true,
+			expectExpires: validTime(now.Add(period)),
+		},
+		{
+			name:          "upgrade uses the provider's expiry",
+			user:          free,
+			event:         Event{Type: EventUpgraded, ExpiresAt: &explicit},
+			expectRed:     true,
+			expectExpires: validTime(explicit),
+		},
+		{
+			name:          "renewal extends from the current expiry",
+			user:          red(inTenDays),
+			event:         Event{Type: EventRenewed},
+			expectRed:     true,
+			expectExpires: validTime(inTenDays.Add(period)),
+		},
+		{
+			name:          "renewal after lapsing starts now",
+			user:          red(tenDaysAgo),
+			event:         Event{Type: EventRenewed},
+			expectRed:     true,
+			expectExpires: validTime(now.Add(period)),
+		},
+		{
+			name:          "renewal uses the provider's expiry",
+			user:          red(inTenDays),
+			event:         Event{Type: EventRenewed, ExpiresAt: &explicit},
+			expectRed:     true,
+			expectExpires: validTime(explicit),
+		},
+		{
+			name:          "cancel keeps red until the period ends",
+			user:          red(inTenDays),
+			event:         Event{Type: EventCancelled},
+			expectRed:     true,
+			expectExpires: validTime(inTenDays),
+		},
+		{
+			name:          "cancel without an expiry ends now",
+			user:          database.User{IsChirpyRed: true},
+			event:         Event{Type: EventCancelled},
+			expectRed:     true,
+			expectExpires: validTime(now),
+		},
+		{
+			name:      "downgrade ends red at once",
+			user:      red(inTenDays),
+			event:     Event{Type: EventDowngraded},
+			expectRed: false,
+		},
+		{
+			name:          "lapsed subscription expires",
+			user:          red(tenDaysAgo),
+			event:         Event{Type: EventExpired},
+			expectRed:     false,
+			expectExpires: validTime(tenDaysAgo),
+		},
+		{
+			name:      "paid subscription does not expire",
+			user:      red(inTenDays),
+			event:     Event{Type: EventExpired},
+			expectErr: errNotLapsed,
+		},
+		{
+			name:      "unknown event",
+			user:      free,
+			event:     Event{Type: "user.teleported"},
+			expectErr: ErrUnknownEvent,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			isRed, expiresAt, err := transition(tc.user, tc.event, now, period)
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatalf("expected error %v, got %v", tc.expectErr, err)
+			}
+			if tc.expectErr != nil {
+				return
+			}
+			if isRed != tc.expectRed {
+				t.Errorf("expected red %v, got %v", tc.expectRed, isRed)
+			}
+			if expiresAt != tc.expectExpires {
+				t.Errorf("expected expiry %v, got %v", tc.expectExpires, expiresAt)
+			}
+		})
+	}
+}
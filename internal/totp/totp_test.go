@@ -0,0 +1,106 @@
+package totp
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// The shared secret of the RFC 4226 and RFC 6238 test vectors.
+var rfcKey = []byte("12345678901234567890")
+
+func TestHOTP(t *testing.T) {
+	// RFC 4226, appendix D.
+	expected := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+
+	for counter, want := range expected {
+		if got := hotp(rfcKey, uint64(counter), 6); got != want {
+			t.Errorf("counter %d: expected %s, got %s", counter, want, got)
+		}
+	}
+}
+
+func TestTOTPVectors(t *testing.T) {
+	// RFC 6238, appendix B, SHA1 rows.
+	cases := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "94287082"},
+		{unix: 1111111109, want: "07081804"},
+		{unix: 1111111111, want: "14050471"},
+		{unix: 1234567890, want: "89005924"},
+		{unix: 2000000000, want: "69279037"},
+		{unix: 20000000000, want: "65353130"},
+	}
+
+	for _, tc := range cases {
+		step := Step(time.Unix(tc.unix, 0))
+		if got := hotp(rfcKey, uint64(step), 8); got != tc.want {
+			t.Errorf("time %d: expected %s, got %s", tc.unix, tc.want, got)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	secret := encoding.EncodeToString(rfcKey)
+	now := time.Unix(1111111111, 0)
+
+	current, err := Code(secret, Step(now))
+	if err != nil {
+		t.Fatalf("Code returned error: %v", err)
+	}
+	previous, _ := Code(secret, Step(now)-1)
+	tooOld, _ := Code(secret, Step(now)-2)
+	next, _ := Code(secret, Step(now)+1)
+
+	cases := []struct {
+		name       string
+		secret     string
+		code       string
+		expectOK   bool
+		expectStep int64
+	}{
+		{name: "current step", secret: secret, code: current, expectOK: true, expectStep: Step(now)},
+		{name: "previous step", secret: secret, code: previous, expectOK: true, expectStep: Step(now) - 1},
+		{name: "next step", secret: secret, code: next, expectOK: true, expectStep: Step(now) + 1},
+		{name: "outside window", secret: secret, code: tooOld},
+		{name: "wrong code", secret: secret, code: "000000"},
+		{name: "short code", secret: secret, code: current[:5]},
+		{name: "invalid secret", secret: "not base32!", code: current},
+		{name: "lower case secret", secret: "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", code: current, expectOK: true, expectStep: Step(now)},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			step, ok := Verify(tc.secret, tc.code, now)
+			if ok != tc.expectOK {
+				t.Fatalf("expected ok %v, got %v", tc.expectOK, ok)
+			}
+			if ok && step != tc.expectStep {
+				t.Errorf("expected step %d, got %d", tc.expectStep, step)
+			}
+		})
+	}
+}
+
+func TestURI(t *testing.T) {
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatalf("NewSecret returned error: %v", err)
+	}
+	if len(secret) != 32 {
+		t.Errorf("expected a 32 character secret, got %q", secret)
+	}
+
+	u, err := url.Parse(URI("Chirpy", "user@example.com", secret))
+	if err != nil {
+		t.Fatalf("invalid URI: %v", err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Chirpy:user@example.com" {
+		t.Errorf("unexpected URI %s", u)
+	}
+	if q := u.Query(); q.Get("secret") != secret || q.Get("issuer") != "Chirpy" || q.Get("digits") != "6" || q.Get("period") != "30" {
+		t.Errorf("unexpected query %s", u.RawQuery)
+	}
+}
@@ -0,0 +1,400 @@
+// Package webauthn implements the relying party side of the WebAuthn
+// registration and authentication ceremonies for passkeys.
+//
+// Only "none" attestation is supported: Chirpy trusts the authenticator the
+// user registers without asking who made it. User verification (a PIN or
+// biometric on the authenticator) is required, so a passkey is a complete
+// login on its own.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Timeout is how long a ceremony may take. Challenges older than this are
+// rejected.
+const Timeout = 5 * time.Minute
+
+const challengeSize = 32
+
+// Authenticator data flags.
+const (
+	flagUserPresent       = 0x01
+	flagUserVerified      = 0x04
+	flagAttestedCredData  = 0x40
+	flagExtensionDataIncl = 0x80
+)
+
+// maxCredentialIDLength is the largest credential ID the spec allows.
+const maxCredentialIDLength = 1023
+
+// ErrSignCount is returned for an assertion whose signature counter did not
+// increase, which suggests the authenticator was cloned.
+var ErrSignCount = errors.New("signature counter did not increase")
+
+// RelyingParty identifies the site passkeys are registered with. ID is the
+// domain passkeys are scoped to, and Origins lists the exact origins, such
+// as https://chirpy.example, that ceremonies may run on.
+type RelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+}
+
+// Credential is a registered passkey.
+type Credential struct {
+	ID        []byte
+	PublicKey []byte // COSE_Key
+	SignCount uint32
+}
+
+// NewChallenge returns a random challenge for one ceremony.
+func NewChallenge() ([]byte, error) {
+	b := make([]byte, challengeSize)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Bytes is binary data sent as unpadded base64url, as in the WebAuthn JSON
+// serialization.
+type Bytes []byte
+
+func (b Bytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *Bytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+// User is the account a passkey is created for. ID is the user handle the
+// authenticator returns on login.
+type User struct {
+	ID          Bytes  `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type credentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+// CredentialDescriptor names an existing credential.
+type CredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   Bytes  `json:"id"`
+}
+
+type rpEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type authenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+// CreationOptions are the options for navigator.credentials.create, in the
+// form PublicKeyCredential.parseCreationOptionsFromJSON accepts.
+type CreationOptions struct {
+	RP                     rpEntity               `json:"rp"`
+	User                   User                   `json:"user"`
+	Challenge              Bytes                  `json:"challenge"`
+	PubKeyCredParams       []credentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection authenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions are the options for navigator.credentials.get, in the form
+// PublicKeyCredential.parseRequestOptionsFromJSON accepts.
+type RequestOptions struct {
+	Challenge        Bytes                  `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// RegistrationResponse is the JSON form of the PublicKeyCredential returned
+// by navigator.credentials.create.
+type RegistrationResponse struct {
+	ID       string `json:"id"`
+	RawID    Bytes  `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    Bytes `json:"clientDataJSON"`
+		AttestationObject Bytes `json:"attestationObject"`
+	} `json:"response"`
+}
+
+// AssertionResponse is the JSON form of the PublicKeyCredential returned by
+// navigator.credentials.get.
+type AssertionResponse struct {
+	ID       string `json:"id"`
+	RawID    Bytes  `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    Bytes `json:"clientDataJSON"`
+		AuthenticatorData Bytes `json:"authenticatorData"`
+		Signature         Bytes `json:"signature"`
+		UserHandle        Bytes `json:"userHandle"`
+	} `json:"response"`
+}
+
+// CreationOptions returns the options for registering a passkey for user.
+// exclude lists the user's existing credentials so an authenticator isn't
+// registered twice.
+func (rp *RelyingParty) CreationOptions(user User, challenge []byte, exclude [][]byte) CreationOptions {
+	params := make([]credentialParameter, len(SupportedAlgorithms))
+	for i, alg := range SupportedAlgorithms {
+		params[i] = credentialParameter{Type: "public-key", Alg: alg}
+	}
+
+	return CreationOptions{
+		RP:                 rpEntity{ID: rp.ID, Name: rp.Name},
+		User:               user,
+		Challenge:          challenge,
+		PubKeyCredParams:   params,
+		Timeout:            Timeout.Milliseconds(),
+		ExcludeCredentials: descriptors(exclude),
+		AuthenticatorSelection: authenticatorSelection{
+			ResidentKey:        "required",
+			RequireResidentKey: true,
+			UserVerification:   "required",
+		},
+		Attestation: "none",
+	}
+}
+
+// RequestOptions returns the options for logging in with a passkey. With no
+// allow list the authenticator offers every passkey it holds for the site.
+func (rp *RelyingParty) RequestOptions(challenge []byte, allow [][]byte) RequestOptions {
+	return RequestOptions{
+		Challenge:        challenge,
+		Timeout:          Timeout.Milliseconds(),
+		RPID:             rp.ID,
+		AllowCredentials: descriptors(allow),
+		UserVerification: "required",
+	}
+}
+
+func descriptors(ids [][]byte) []CredentialDescriptor {
+	out := make([]CredentialDescriptor, len(ids))
+	for i, id := range ids {
+		out[i] = CredentialDescriptor{Type: "public-key", ID: id}
+	}
+	return out
+}
+
+// VerifyRegistration checks the response to a registration ceremony started
+// with challenge and returns the new credential.
+func (rp *RelyingParty) VerifyRegistration(challenge []byte, res *RegistrationResponse) (*Credential, error) {
+	if res.Type != "public-key" {
+		return nil, errors.New("unsupported credential type")
+	}
+	if err := rp.verifyClientData(res.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	v, rest, err := decodeCBOR(res.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("attestation object: %w", err)
+	}
+	att, ok := v.(map[any]any)
+	if !ok || len(rest) != 0 {
+		return nil, errors.New("malformed attestation object")
+	}
+	if format, _ := att["fmt"].(string); format != "none" {
+		return nil, fmt.Errorf("unsupported attestation format %q", format)
+	}
+	if stmt, ok := att["attStmt"].(map[any]any); !ok || len(stmt) != 0 {
+		return nil, errors.New("attestation statement must be empty")
+	}
+	rawAuthData, _ := att["authData"].([]byte)
+
+	authData, err := rp.verifyAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if authData.flags&flagAttestedCredData == 0 {
+		return nil, errors.New("no credential in authenticator data")
+	}
+	if !bytes.Equal(authData.credentialID, res.RawID) {
+		return nil, errors.New("credential ID mismatch")
+	}
+	if _, err := parsePublicKey(authData.publicKey); err != nil {
+		return nil, fmt.Errorf("credential public key: %w", err)
+	}
+
+	return &Credential{
+		ID:        authData.credentialID,
+		PublicKey: authData.publicKey,
+		SignCount: authData.signCount,
+	}, nil
+}
+
+// VerifyAssertion checks the response to an authentication ceremony started
+// with challenge against the stored credential it names, and returns the new
+// signature counter to store.
+func (rp *RelyingParty) VerifyAssertion(challenge []byte, cred *Credential, res *AssertionResponse) (uint32, error) {
+	if res.Type != "public-key" {
+		return 0, errors.New("unsupported credential type")
+	}
+	if !bytes.Equal(cred.ID, res.RawID) {
+		return 0, errors.New("credential ID mismatch")
+	}
+	if err := rp.verifyClientData(res.Response.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	authData, err := rp.verifyAuthenticatorData(res.Response.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+
+	key, err := parsePublicKey(cred.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(res.Response.ClientDataJSON)
+	signed := append(slices.Clip(res.Response.AuthenticatorData), clientDataHash[:]...)
+	if !key.verify(signed, res.Response.Signature) {
+		return 0, errors.New("invalid signature")
+	}
+
+	// Authenticators that don't count always send 0.
+	if (authData.signCount != 0 || cred.SignCount != 0) && authData.signCount <= cred.SignCount {
+		return 0, ErrSignCount
+	}
+
+	return authData.signCount, nil
+}
+
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+func (rp *RelyingParty) verifyClientData(data []byte, ceremony string, challenge []byte) error {
+	var cd clientData
+	if err := json.Unmarshal(data, &cd); err != nil {
+		return fmt.Errorf("client data: %w", err)
+	}
+	if cd.Type != ceremony {
+		return fmt.Errorf("client data type is %q, want %q", cd.Type, ceremony)
+	}
+	got, err := base64.RawURLEncoding.DecodeString(cd.Challenge)
+	if err != nil || !bytes.Equal(got, challenge) {
+		return errors.New("challenge mismatch")
+	}
+	if !slices.Contains(rp.Origins, cd.Origin) {
+		return fmt.Errorf("origin %q is not allowed", cd.Origin)
+	}
+	if cd.CrossOrigin {
+		return errors.New("cross-origin ceremonies are not allowed")
+	}
+	return nil
+}
+
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+// verifyAuthenticatorData parses authenticator data and checks it is scoped
+// to the relying party and that the user was present and verified.
+func (rp *RelyingParty) verifyAuthenticatorData(data []byte) (*authenticatorData, error) {
+	ad, err := parseAuthenticatorData(data)
+	if err != nil {
+		return nil, err
+	}
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(ad.rpIDHash, rpIDHash[:]) {
+		return nil, errors.New("RP ID mismatch")
+	}
+	if ad.flags&flagUserPresent == 0 {
+		return nil, errors.New("user not present")
+	}
+	if ad.flags&flagUserVerified == 0 {
+		return nil, errors.New("user not verified")
+	}
+	return ad, nil
+}
+
+func parseAuthenticatorData(b []byte) (*authenticatorData, error) {
+	if len(b) < 37 {
+		return nil, errors.New("authenticator data too short")
+	}
+	ad := &authenticatorData{
+		rpIDHash:  b[:32],
+		flags:     b[32],
+		signCount: binary.BigEndian.Uint32(b[33:37]),
+	}
+	rest := b[37:]
+
+	if ad.flags&flagAttestedCredData != 0 {
+		// AAGUID, then the credential ID and its length.
+		if len(rest) < 18 {
+			return nil, errors.New("attested credential data too short")
+		}
+		n := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if n > maxCredentialIDLength || len(rest) < n {
+			return nil, errors.New("invalid credential ID length")
+		}
+		ad.credentialID, rest = rest[:n], rest[n:]
+
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("credential public key: %w", err)
+		}
+		ad.publicKey, rest = rest[:len(rest)-len(after)], after
+	}
+
+	if ad.flags&flagExtensionDataIncl != 0 {
+		v, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("extensions: %w", err)
+		}
+		if _, ok := v.(map[any]any); !ok {
+			return nil, errors.New("extensions are not a map")
+		}
+		rest = after
+	}
+
+	if len(rest) != 0 {
+		return nil, errors.New("trailing data in authenticator data")
+	}
+	return ad, nil
+}
@@ -0,0 +1,412 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// cborPair is a map entry for encodeCBOR. Maps are written as pair slices so
+// the encoding is in a fixed order.
+type cborPair struct {
+	k, v any
+}
+
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n < 1<<8:
+		return []byte{major<<5 | 24, byte(n)}
+	case n < 1<<16:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+	case n < 1<<32:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64([]byte{major<<5 | 27}, n)
+	}
+}
+
+func encodeCBOR(v any) []byte {
+	switch v := v.(type) {
+	case int:
+		if v < 0 {
+			return cborHead(1, uint64(-1-v))
+		}
+		return cborHead(0, uint64(v))
+	case []byte:
+		return append(cborHead(2, uint64(len(v))), v...)
+	case string:
+		return append(cborHead(3, uint64(len(v))), v...)
+	case []any:
+		out := cborHead(4, uint64(len(v)))
+		for _, item := range v {
+			out = append(out, encodeCBOR(item)...)
+		}
+		return out
+	case []cborPair:
+		out := cborHead(5, uint64(len(v)))
+		for _, p := range v {
+			out = append(out, encodeCBOR(p.k)...)
+			out = append(out, encodeCBOR(p.v)...)
+		}
+		return out
+	case bool:
+		if v {
+			return []byte{0xf5}
+		}
+		return []byte{0xf4}
+	case nil:
+		return []byte{0xf6}
+	}
+	panic("encodeCBOR: unsupported type")
+}
+
+// softAuthenticator is an in-memory passkey authenticator holding a single
+// credential. It answers ceremonies as a browser and authenticator would,
+// with "none" attestation.
+type softAuthenticator struct {
+	rpID      string
+	origin    string
+	key       crypto.Signer
+	id        []byte
+	signCount uint32
+	flags     byte
+}
+
+func newSoftAuthenticator(t *testing.T, rpID, origin string, alg int) *softAuthenticator {
+	t.Helper()
+
+	var key crypto.Signer
+	var err error
+	switch alg {
+	case AlgES256:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		t.Fatalf("unsupported algorithm %d", alg)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	return &softAuthenticator{
+		rpID:   rpID,
+		origin: origin,
+		key:    key,
+		id:     id,
+		flags:  flagUserPresent | flagUserVerified,
+	}
+}
+
+func (a *softAuthenticator) coseKey() []byte {
+	switch pub := a.key.Public().(type) {
+	case *ecdsa.PublicKey:
+		return encodeCBOR([]cborPair{
+			{coseKty, ktyEC2},
+			{coseAlg, AlgES256},
+			{coseCrv, crvP256},
+			{coseX, pub.X.FillBytes(make([]byte, 32))},
+			{coseY, pub.Y.FillBytes(make([]byte, 32))},
+		})
+	case ed25519.PublicKey:
+		return encodeCBOR([]cborPair{
+			{coseKty, ktyOKP},
+			{coseAlg, AlgEdDSA},
+			{coseCrv, crvEd25519},
+			{coseX, []byte(pub)},
+		})
+	}
+	panic("unsupported key")
+}
+
+func (a *softAuthenticator) clientData(ceremony string, challenge []byte) []byte {
+	data, _ := json.Marshal(clientData{
+		Type:      ceremony,
+		Challenge: base64.RawURLEncoding.EncodeToString(challenge),
+		Origin:    a.origin,
+	})
+	return data
+}
+
+func (a *softAuthenticator) authData(flags byte, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	out := append(rpIDHash[:], flags)
+	out = binary.BigEndian.AppendUint32(out, a.signCount)
+	return append(out, attested...)
+}
+
+func (a *softAuthenticator) create(challenge []byte) *RegistrationResponse {
+	attested := make([]byte, 16) // zero AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.id)))
+	attested = append(attested, a.id...)
+	attested = append(attested, a.coseKey()...)
+
+	res := &RegistrationResponse{ID: base64.RawURLEncoding.EncodeToString(a.id), RawID: a.id, Type: "public-key"}
+	res.Response.ClientDataJSON = a.clientData("webauthn.create", challenge)
+	res.Response.AttestationObject = encodeCBOR([]cborPair{
+		{"fmt", "none"},
+		{"attStmt", []cborPair{}},
+		{"authData", a.authData(a.flags|flagAttestedCredData, attested)},
+	})
+	return res
+}
+
+func (a *softAuthenticator) get(t *testing.T, challenge, userHandle []byte) *AssertionResponse {
+	t.Helper()
+
+	a.signCount++
+	authData := a.authData(a.flags, nil)
+	clientDataJSON := a.clientData("webauthn.get", challenge)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(authData, clientDataHash[:]...)
+
+	var sig []byte
+	var err error
+	if _, ok := a.key.(ed25519.PrivateKey); ok {
+		sig, err = a.key.Sign(rand.Reader, signed, crypto.Hash(0))
+	} else {
+		sum := sha256.Sum256(signed)
+		sig, err = a.key.Sign(rand.Reader, sum[:], crypto.SHA256)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := &AssertionResponse{ID: base64.RawURLEncoding.EncodeToString(a.id), RawID: a.id, Type: "public-key"}
+	res.Response.ClientDataJSON = clientDataJSON
+	res.Response.AuthenticatorData = authData
+	res.Response.Signature = sig
+	res.Response.UserHandle = userHandle
+	return res
+}
+
+var testRP = &RelyingParty{ID: "localhost", Name: "Chirpy", Origins: []string{"http://localhost:8080"}}
+
+func mustChallenge(t *testing.T) []byte {
+	t.Helper()
+	c, err := NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	for _, alg := range []int{AlgES256, AlgEdDSA} {
+		a := newSoftAuthenticator(t, "localhost", "http://localhost:8080", alg)
+
+		challenge := mustChallenge(t)
+		cred, err := testRP.VerifyRegistration(challenge, a.create(challenge))
+		if err != nil {
+			t.Fatalf("alg %d: VerifyRegistration: %v", alg, err)
+		}
+		if !bytes.Equal(cred.ID, a.id) {
+			t.Errorf("alg %d: credential ID = %x, want %x", alg, cred.ID, a.id)
+		}
+
+		for i := 1; i <= 2; i++ {
+			challenge := mustChallenge(t)
+			count, err := testRP.VerifyAssertion(challenge, cred, a.get(t, challenge, nil))
+			if err != nil {
+				t.Fatalf("alg %d: VerifyAssertion: %v", alg, err)
+			}
+			if count != uint32(i) {
+				t.Errorf("alg %d: sign count = %d, want %d", alg, count, i)
+			}
+			cred.SignCount = count
+		}
+	}
+}
+
+func TestVerifyRegistrationRejects(t *testing.T) {
+	challenge := mustChallenge(t)
+
+	tests := []struct {
+		name   string
+		modify func(a *softAuthenticator)
+		res    func(a *softAuthenticator) *RegistrationResponse
+	}{
+		{
+			name: "wrong challenge",
+			res:  func(a *softAuthenticator) *RegistrationResponse { return a.create(mustChallenge(t)) },
+		},
+		{
+			name:   "wrong origin",
+			modify: func(a *softAuthenticator) { a.origin = "https://evil.example" },
+		},
+		{
+			name:   "wrong RP ID",
+			modify: func(a *softAuthenticator) { a.rpID = "evil.example" },
+		},
+		{
+			name:   "user not verified",
+			modify: func(a *softAuthenticator) { a.flags = flagUserPresent },
+		},
+		{
+			name:   "user not present",
+			modify: func(a *softAuthenticator) { a.flags = flagUserVerified },
+		},
+		{
+			name: "attestation format",
+			res: func(a *softAuthenticator) *RegistrationResponse {
+				res := a.create(challenge)
+				v, _, _ := decodeCBOR(res.Response.AttestationObject)
+				res.Response.AttestationObject = encodeCBOR([]cborPair{
+					{"fmt", "packed"},
+					{"attStmt", []cborPair{}},
+					{"authData", v.(map[any]any)["authData"]},
+				})
+				return res
+			},
+		},
+		{
+			name: "client data type",
+			res: func(a *softAuthenticator) *RegistrationResponse {
+				res := a.create(challenge)
+				res.Response.ClientDataJSON = a.clientData("webauthn.get", challenge)
+				return res
+			},
+		},
+		{
+			name: "raw ID mismatch",
+			res: func(a *softAuthenticator) *RegistrationResponse {
+				res := a.create(challenge)
+				res.RawID = []byte("other")
+				return res
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newSoftAuthenticator(t, "localhost", "http://localhost:8080", AlgES256)
+			if tt.modify != nil {
+				tt.modify(a)
+			}
+			var res *RegistrationResponse
+			if tt.res != nil {
+				res = tt.res(a)
+			} else {
+				res = a.create(challenge)
+			}
+			if _, err := testRP.VerifyRegistration(challenge, res); err == nil {
+				t.Error("VerifyRegistration succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestVerifyAssertionRejects(t *testing.T) {
+	a := newSoftAuthenticator(t, "localhost", "http://localhost:8080", AlgES256)
+	challenge := mustChallenge(t)
+	cred, err := testRP.VerifyRegistration(challenge, a.create(challenge))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("bad signature", func(t *testing.T) {
+		res := a.get(t, challenge, nil)
+		res.Response.Signature[len(res.Response.Signature)-1] ^= 1
+		if _, err := testRP.VerifyAssertion(challenge, cred, res); err == nil {
+			t.Error("VerifyAssertion succeeded, want error")
+		}
+	})
+
+	t.Run("wrong challenge", func(t *testing.T) {
+		res := a.get(t, mustChallenge(t), nil)
+		if _, err := testRP.VerifyAssertion(challenge, cred, res); err == nil {
+			t.Error("VerifyAssertion succeeded, want error")
+		}
+	})
+
+	t.Run("other key", func(t *testing.T) {
+		other := newSoftAuthenticator(t, "localhost", "http://localhost:8080", AlgES256)
+		other.id = a.id
+		if _, err := testRP.VerifyAssertion(challenge, cred, other.get(t, challenge, nil)); err == nil {
+			t.Error("VerifyAssertion succeeded, want error")
+		}
+	})
+
+	t.Run("sign count regression", func(t *testing.T) {
+		stored := *cred
+		stored.SignCount = a.signCount + 5
+		_, err := testRP.VerifyAssertion(challenge, &stored, a.get(t, challenge, nil))
+		if !errors.Is(err, ErrSignCount) {
+			t.Errorf("err = %v, want ErrSignCount", err)
+		}
+	})
+
+	t.Run("zero sign count", func(t *testing.T) {
+		stored := *cred
+		stored.SignCount = 0
+		a.signCount = ^uint32(0) // wraps to 0 on the next assertion
+		count, err := testRP.VerifyAssertion(challenge, &stored, a.get(t, challenge, nil))
+		if err != nil || count != 0 {
+			t.Errorf("VerifyAssertion = %d, %v; want 0, nil", count, err)
+		}
+	})
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	// Examples from RFC 8949 Appendix A.
+	tests := []struct {
+		in   string
+		want any
+	}{
+		{"00", int64(0)},
+		{"17", int64(23)},
+		{"1818", int64(24)},
+		{"1903e8", int64(1000)},
+		{"1b000000e8d4a51000", int64(1000000000000)},
+		{"20", int64(-1)},
+		{"3903e7", int64(-1000)},
+		{"f4", false},
+		{"f5", true},
+		{"f6", nil},
+		{"4401020304", []byte{1, 2, 3, 4}},
+		{"6449455446", "IETF"},
+		{"83010203", []any{int64(1), int64(2), int64(3)}},
+		{"a201020304", map[any]any{int64(1): int64(2), int64(3): int64(4)}},
+		{"a26161016162820203", map[any]any{"a": int64(1), "b": []any{int64(2), int64(3)}}},
+	}
+
+	for _, tt := range tests {
+		in, _ := hex.DecodeString(tt.in)
+		got, rest, err := decodeCBOR(in)
+		if err != nil || len(rest) != 0 || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("decodeCBOR(%s) = %#v, %x, %v; want %#v", tt.in, got, rest, err, tt.want)
+		}
+	}
+
+	for _, in := range []string{
+		"",                   // empty
+		"18",                 // truncated argument
+		"45010203",           // truncated byte string
+		"9f01ff",             // indefinite length
+		"c11a514b67b0",       // tag
+		"fb3ff199999999999a", // float
+		"a2010201",           // duplicate key
+		"9bffffffffffffffff", // huge array
+	} {
+		b, _ := hex.DecodeString(in)
+		if _, _, err := decodeCBOR(b); err == nil {
+			t.Errorf("decodeCBOR(%s) succeeded, want error", in)
+		}
+	}
+}
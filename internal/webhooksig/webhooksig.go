@@ -0,0 +1,113 @@
+package webhooksig
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTolerance is how far a signature timestamp may drift from the
+// local clock before the request is rejected.
+const DefaultTolerance = 5 * time.Minute
+
+var (
+	ErrMissingSignature = errors.New("missing signature header")
+	ErrInvalidHeader    = errors.New("invalid signature header format")
+	ErrTimestamp        = errors.New("signature timestamp outside tolerance")
+	ErrNoMatch          = errors.New("no matching signature")
+)
+
+// Sign returns the hex HMAC-SHA256 of "<unix timestamp>.<body>".
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Header formats a signature header value, "t=<unix>,v1=<hex>", with one
+// v1 entry per secret so a sender can sign with old and new secrets while
+// they are being rotated.
+func Header(timestamp time.Time, body []byte, secrets ...string) string {
+	parts := []string{"t=" + strconv.FormatInt(timestamp.Unix(), 10)}
+	for _, secret := range secrets {
+		parts = append(parts, "v1="+Sign(secret, timestamp, body))
+	}
+	return strings.Join(parts, ",")
+}
+
+// Verifier checks signature headers against a set of active secrets. Any
+// secret may match, which lets a provider rotate without downtime.
+type Verifier struct {
+	Secrets   []string
+	Tolerance time.Duration
+	Now       func() time.Time
+}
+
+func NewVerifier(secrets []string) *Verifier {
+	return &Verifier{
+		Secrets:   secrets,
+		Tolerance: DefaultTolerance,
+		Now:       time.Now,
+	}
+}
+
+// Verify checks header against body. It returns nil if any v1 signature in
+// the header was made with any of the verifier's secrets.
+func (v *Verifier) Verify(header string, body []byte) error {
+	if header == "" {
+		return ErrMissingSignature
+	}
+
+	var timestamp int64
+	var signatures [][]byte
+	hasTimestamp := false
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return ErrInvalidHeader
+		}
+		switch key {
+		case "t":
+			ts, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return ErrInvalidHeader
+			}
+			timestamp = ts
+			hasTimestamp = true
+		case "v1":
+			sig, err := hex.DecodeString(value)
+			if err != nil {
+				return ErrInvalidHeader
+			}
+			signatures = append(signatures, sig)
+		}
+	}
+	if !hasTimestamp || len(signatures) == 0 {
+		return ErrInvalidHeader
+	}
+
+	signedAt := time.Unix(timestamp, 0)
+	drift := v.Now().Sub(signedAt)
+	if drift < 0 {
+		drift = -drift
+	}
+	if drift > v.Tolerance {
+		return ErrTimestamp
+	}
+
+	for _, secret := range v.Secrets {
+		expected, _ := hex.DecodeString(Sign(secret, signedAt, body))
+		for _, sig := range signatures {
+			if hmac.Equal(expected, sig) {
+				return nil
+			}
+		}
+	}
+	return ErrNoMatch
+}
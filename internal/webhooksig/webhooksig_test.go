@@ -0,0 +1,105 @@
+package webhooksig
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"event":"user.upgraded"}`)
+
+	cases := []struct {
+		name        string
+		secrets     []string
+		header      string
+		body        []byte
+		expectError error
+	}{
+		{
+			name:    "valid signature",
+			secrets: []string{"current"},
+			header:  Header(now, body, "current"),
+			body:    body,
+		},
+		{
+			name:    "signed with previous secret during rotation",
+			secrets: []string{"next", "current"},
+			header:  Header(now, body, "current"),
+			body:    body,
+		},
+		{
+			name:    "sender signs with two secrets",
+			secrets: []string{"next"},
+			header:  Header(now, body, "current", "next"),
+			body:    body,
+		},
+		{
+			name:    "within tolerance",
+			secrets: []string{"current"},
+			header:  Header(now.Add(-4*time.Minute), body, "current"),
+			body:    body,
+		},
+		{
+			name:        "wrong secret",
+			secrets:     []string{"current"},
+			header:      Header(now, body, "other"),
+			body:        body,
+			expectError: ErrNoMatch,
+		},
+		{
+			name:        "tampered body",
+			secrets:     []string{"current"},
+			header:      Header(now, body, "current"),
+			body:        []byte(`{"event":"user.downgraded"}`),
+			expectError: ErrNoMatch,
+		},
+		{
+			name:        "too old",
+			secrets:     []string{"current"},
+			header:      Header(now.Add(-6*time.Minute), body, "current"),
+			body:        body,
+			expectError: ErrTimestamp,
+		},
+		{
+			name:        "too far in the future",
+			secrets:     []string{"current"},
+			header:      Header(now.Add(6*time.Minute), body, "current"),
+			body:        body,
+			expectError: ErrTimestamp,
+		},
+		{
+			name:        "missing header",
+			secrets:     []string{"current"},
+			body:        body,
+			expectError: ErrMissingSignature,
+		},
+		{
+			name:        "missing timestamp",
+			secrets:     []string{"current"},
+			header:      "v1=" + Sign("current", now, body),
+			body:        body,
+			expectError: ErrInvalidHeader,
+		},
+		{
+			name:        "non hex signature",
+			secrets:     []string{"current"},
+			header:      "t=1700000000,v1=zz",
+			body:        body,
+			expectError: ErrInvalidHeader,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			v := NewVerifier(tc.secrets)
+			v.Now = func() time.Time { return now }
+
+			err := v.Verify(tc.header, tc.body)
+			if !errors.Is(err, tc.expectError) {
+				t.Errorf("expected error %v, got %v", tc.expectError, err)
+			}
+		})
+	}
+}
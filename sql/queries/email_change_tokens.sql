@@ -0,0 +1,13 @@
+-- name: CreateEmailChangeToken :exec
+INSERT INTO email_change_tokens (token_hash, user_id, old_email, new_email, expires_at, created_at)
+VALUES ($1, $2, $3, $4, $5, NOW());
+
+-- name: GetEmailChangeTokenForUpdate :one
+SELECT * FROM email_change_tokens WHERE token_hash = $1 FOR UPDATE;
+
+-- name: UseUserEmailChangeTokens :exec
+UPDATE email_change_tokens SET used_at = NOW()
+WHERE user_id = $1 AND used_at IS NULL;
+
+-- name: DeleteExpiredEmailChangeTokens :exec
+DELETE FROM email_change_tokens WHERE expires_at < (now() AT TIME ZONE 'UTC');
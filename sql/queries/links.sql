@@ -0,0 +1,15 @@
+-- name: CreateLink :one
+INSERT INTO links (id, chirp_id, code, url, start_index, end_index, created_at, updated_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, NOW(), NOW())
+RETURNING *;
+
+-- name: GetLinksByChirpIDs :many
+SELECT * FROM links
+WHERE chirp_id = ANY(sqlc.arg(chirp_ids)::uuid[])
+ORDER BY chirp_id, start_index ASC;
+
+-- name: RecordLinkClick :one
+UPDATE links
+SET clicks = clicks + 1, updated_at = NOW()
+WHERE code = $1
+RETURNING *;
@@ -0,0 +1,37 @@
+-- name: EnsureLoginThrottle :exec
+INSERT INTO login_throttles (kind, subject, failure_count, last_failed_at)
+VALUES ($1, $2, 0, $3)
+ON CONFLICT (kind, subject) DO NOTHING;
+
+-- name: GetLoginThrottleForUpdate :one
+SELECT * FROM login_throttles WHERE kind = $1 AND subject = $2 FOR UPDATE;
+
+-- name: UpdateLoginThrottle :exec
+UPDATE login_throttles
+SET failure_count = $3, last_failed_at = $4, locked_until = $5
+WHERE kind = $1 AND subject = $2;
+
+-- name: ForgiveLoginFailure :exec
+UPDATE login_throttles SET failure_count = failure_count - 1
+WHERE kind = $1 AND subject = $2 AND failure_count > 0;
+
+-- name: DeleteLoginThrottle :exec
+DELETE FROM login_throttles WHERE kind = $1 AND subject = $2;
+
+-- name: DeleteStaleLoginThrottles :exec
+DELETE FROM login_throttles
+WHERE last_failed_at < $1
+  AND (locked_until IS NULL OR locked_until < (now() AT TIME ZONE 'UTC'));
+
+-- name: ListLoginThrottles :many
+SELECT login_throttles.kind, login_throttles.subject, login_throttles.failure_count,
+       login_throttles.last_failed_at, login_throttles.locked_until, users.id AS user_id
+FROM login_throttles
+LEFT JOIN users ON login_throttles.kind = 'account' AND lower(users.email) = login_throttles.subject
+WHERE login_throttles.kind IN ('account', 'ip')
+  AND login_throttles.failure_count > 0
+  AND (login_throttles.last_failed_at >= $1 OR login_throttles.locked_until > (now() AT TIME ZONE 'UTC'))
+ORDER BY login_throttles.last_failed_at DESC;
+
+-- name: DeleteAllLoginThrottles :exec
+DELETE FROM login_throttles;
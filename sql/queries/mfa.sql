@@ -0,0 +1,51 @@
+-- name: GetUserTOTP :one
+SELECT * FROM user_totp WHERE user_id = $1;
+
+-- name: StartTOTPEnrollment :one
+INSERT INTO user_totp (user_id, secret, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret, created_at = EXCLUDED.created_at, last_used_step = NULL
+WHERE user_totp.confirmed_at IS NULL
+RETURNING *;
+
+-- name: ConfirmTOTP :execrows
+UPDATE user_totp SET confirmed_at = NOW(), last_used_step = $2
+WHERE user_id = $1 AND confirmed_at IS NULL;
+
+-- name: UseTOTPStep :execrows
+UPDATE user_totp SET last_used_step = $2
+WHERE user_id = $1 AND (last_used_step IS NULL OR last_used_step < $2);
+
+-- name: DeleteUserTOTP :exec
+DELETE FROM user_totp WHERE user_id = $1;
+
+-- name: CreateRecoveryCode :exec
+INSERT INTO recovery_codes (user_id, code_hash, created_at)
+VALUES ($1, $2, NOW());
+
+-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes SET used_at = NOW()
+WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;
+
+-- name: CountUnusedRecoveryCodes :one
+SELECT COUNT(*) FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL;
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_codes WHERE user_id = $1;
+
+-- name: CreateMFAChallenge :exec
+INSERT INTO mfa_challenges (token_hash, user_id, expires_at, created_at)
+VALUES ($1, $2, $3, NOW());
+
+-- name: GetMFAChallengeForUpdate :one
+SELECT * FROM mfa_challenges WHERE token_hash = $1 FOR UPDATE;
+
+-- name: RecordMFAChallengeAttempt :exec
+UPDATE mfa_challenges SET attempts = attempts + 1 WHERE token_hash = $1;
+
+-- name: UseMFAChallenge :exec
+UPDATE mfa_challenges SET used_at = NOW() WHERE token_hash = $1;
+
+-- name: DeleteExpiredMFAChallenges :exec
+DELETE FROM mfa_challenges WHERE expires_at < (now() AT TIME ZONE 'UTC');
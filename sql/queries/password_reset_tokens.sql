@@ -0,0 +1,19 @@
+-- name: CreatePasswordResetToken :exec
+INSERT INTO password_reset_tokens (token_hash, user_id, expires_at, created_at)
+VALUES ($1, $2, $3, NOW());
+
+-- name: GetPasswordResetTokenForUpdate :one
+SELECT * FROM password_reset_tokens WHERE token_hash = $1 FOR UPDATE;
+
+-- name: HasPasswordResetTokenExpiringAfter :one
+SELECT EXISTS (
+    SELECT 1 FROM password_reset_tokens
+    WHERE user_id = $1 AND used_at IS NULL AND expires_at > $2
+);
+
+-- name: UseUserPasswordResetTokens :exec
+UPDATE password_reset_tokens SET used_at = NOW()
+WHERE user_id = $1 AND used_at IS NULL;
+
+-- name: DeleteExpiredPasswordResetTokens :exec
+DELETE FROM password_reset_tokens WHERE expires_at < (now() AT TIME ZONE 'UTC');
@@ -0,0 +1,27 @@
+-- name: CreateSession :one
+INSERT INTO sessions (id, user_id, user_agent, ip, created_at, last_used_at)
+VALUES (gen_random_uuid(), $1, $2, $3, NOW(), NOW())
+RETURNING *;
+
+-- name: GetActiveSessionsByUserID :many
+SELECT * FROM sessions s
+WHERE s.user_id = $1 AND s.revoked_at IS NULL AND EXISTS (
+    SELECT 1 FROM refresh_tokens t
+    WHERE t.family_id = s.id AND t.revoked_at IS NULL AND t.expires_at > (now() AT TIME ZONE 'UTC')
+)
+ORDER BY s.last_used_at DESC;
+
+-- name: TouchSession :exec
+UPDATE sessions SET last_used_at = NOW() WHERE id = $1;
+
+-- name: RevokeSession :execrows
+UPDATE sessions SET revoked_at = NOW()
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeOtherSessions :many
+UPDATE sessions SET revoked_at = NOW()
+WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL
+RETURNING id;
+
+-- name: GetSessionRevokedAt :one
+SELECT revoked_at FROM sessions WHERE id = $1;
@@ -0,0 +1,9 @@
+-- name: CreateSubscriptionHistory :one
+INSERT INTO subscription_history (id, user_id, event, is_chirpy_red, red_expires_at, created_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, NOW())
+RETURNING *;
+
+-- name: GetSubscriptionHistoryByUserID :many
+SELECT * FROM subscription_history
+WHERE user_id = $1
+ORDER BY created_at ASC;
@@ -14,8 +14,56 @@ SELECT * FROM users WHERE id = $1;
 -- name: GetUserByEmail :one
 SELECT * FROM users WHERE email = $1;
 
--- name: UpdateUser :one
-UPDATE users SET email = $2, hashed_password = $3, updated_at = now() WHERE id = $1 RETURNING *;
-
 -- name: UpdateUserIsChirpyRed :one
 UPDATE users SET is_chirpy_red = $2, updated_at = now() WHERE id = $1 RETURNING *;
+
+-- name: UpdateUserPreferences :one
+UPDATE users SET expand_sensitive = $2, updated_at = now() WHERE id = $1 RETURNING *;
+
+-- name: GetUserByIDForUpdate :one
+SELECT * FROM users WHERE id = $1 FOR UPDATE;
+
+-- name: UpdateUserSubscription :one
+UPDATE users SET is_chirpy_red = $2, red_expires_at = $3, subscription_event_at = $4, updated_at = now() WHERE id = $1 RETURNING *;
+
+-- name: ListLapsedSubscriptionsForUpdate :many
+SELECT * FROM users
+WHERE is_chirpy_red AND red_expires_at IS NOT NULL AND red_expires_at <= (now() AT TIME ZONE 'UTC')
+FOR UPDATE;
+
+-- name: GetUserSessionsValidAfter :one
+SELECT sessions_valid_after FROM users WHERE id = $1;
+
+-- name: InvalidateUserAccessTokens :exec
+UPDATE users SET sessions_valid_after = date_trunc('second', now() AT TIME ZONE 'UTC')
+WHERE id = $1;
+
+-- name: UpdateUserRole :one
+UPDATE users
+SET role = $2, sessions_valid_after = date_trunc('second', now() AT TIME ZONE 'UTC'), updated_at = now()
+WHERE id = $1
+RETURNING *;
+
+-- name: LockAdminBootstrap :exec
+-- Held until the transaction ends so bootstraps run one at a time and each
+-- sees whether an earlier one made an admin.
+SELECT pg_advisory_xact_lock(hashtext('chirpy_admin_bootstrap'));
+
+-- name: BootstrapAdmin :one
+UPDATE users
+SET role = 'admin', sessions_valid_after = date_trunc('second', now() AT TIME ZONE 'UTC'), updated_at = now()
+WHERE users.id = $1 AND NOT EXISTS (SELECT 1 FROM users admins WHERE admins.role = 'admin')
+RETURNING *;
+
+-- name: VerifyUserEmail :one
+UPDATE users SET email_verified_at = COALESCE(email_verified_at, now()), updated_at = now()
+WHERE id = $1 AND email = $2
+RETURNING *;
+
+-- name: UpdateUserPassword :one
+UPDATE users SET hashed_password = $2, updated_at = now() WHERE id = $1 RETURNING *;
+
+-- name: UpdateUserEmail :one
+UPDATE users SET email = $2, email_verified_at = now(), updated_at = now()
+WHERE id = $1 AND email = sqlc.arg(old_email)
+RETURNING *;
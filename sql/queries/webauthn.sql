@@ -0,0 +1,29 @@
+-- name: CreateWebAuthnCredential :one
+INSERT INTO webauthn_credentials (id, user_id, credential_id, public_key, sign_count, name, created_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, NOW())
+RETURNING *;
+
+-- name: GetWebAuthnCredentialByCredentialID :one
+SELECT * FROM webauthn_credentials WHERE credential_id = $1;
+
+-- name: GetWebAuthnCredentialsByUserID :many
+SELECT * FROM webauthn_credentials WHERE user_id = $1 ORDER BY created_at;
+
+-- name: UseWebAuthnCredential :execrows
+UPDATE webauthn_credentials SET sign_count = $2, last_used_at = NOW()
+WHERE id = $1 AND sign_count = $3;
+
+-- name: DeleteWebAuthnCredential :execrows
+DELETE FROM webauthn_credentials WHERE id = $1 AND user_id = $2;
+
+-- name: CreateWebAuthnChallenge :one
+INSERT INTO webauthn_challenges (id, user_id, ceremony, challenge, expires_at, created_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, NOW())
+RETURNING *;
+
+-- name: ConsumeWebAuthnChallenge :one
+DELETE FROM webauthn_challenges WHERE id = $1 AND ceremony = $2
+RETURNING *;
+
+-- name: DeleteExpiredWebAuthnChallenges :exec
+DELETE FROM webauthn_challenges WHERE expires_at < (now() AT TIME ZONE 'UTC');
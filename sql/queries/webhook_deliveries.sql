@@ -0,0 +1,29 @@
+-- name: CreateWebhookDelivery :exec
+INSERT INTO webhook_deliveries (id, endpoint_id, event_id, event_type, payload, status, attempts, next_attempt_at, created_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, 'pending', 0, (now() AT TIME ZONE 'UTC'), NOW());
+
+-- name: ClaimDueWebhookDeliveries :many
+UPDATE webhook_deliveries
+SET next_attempt_at = $1, attempts = attempts + 1, last_attempt_at = NOW()
+WHERE id IN (
+    SELECT d.id FROM webhook_deliveries d
+    JOIN webhook_endpoints e ON e.id = d.endpoint_id
+    WHERE d.status = 'pending' AND e.enabled AND d.next_attempt_at <= (now() AT TIME ZONE 'UTC')
+    ORDER BY d.next_attempt_at
+    LIMIT $2
+    FOR UPDATE OF d SKIP LOCKED
+)
+RETURNING *;
+
+-- name: MarkWebhookDeliverySucceeded :exec
+UPDATE webhook_deliveries
+SET status = 'delivered', delivered_at = NOW(), response_status = $2, error = NULL
+WHERE id = $1;
+
+-- name: MarkWebhookDeliveryFailed :exec
+UPDATE webhook_deliveries
+SET status = $2, next_attempt_at = $3, response_status = $4, error = $5
+WHERE id = $1;
+
+-- name: ListWebhookDeliveriesByEndpointID :many
+SELECT * FROM webhook_deliveries WHERE endpoint_id = $1 ORDER BY created_at DESC LIMIT $2;
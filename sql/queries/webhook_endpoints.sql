@@ -0,0 +1,32 @@
+-- name: CreateWebhookEndpoint :one
+INSERT INTO webhook_endpoints (id, user_id, url, secret, events, created_at, updated_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, NOW(), NOW())
+RETURNING *;
+
+-- name: GetWebhookEndpoint :one
+SELECT * FROM webhook_endpoints WHERE id = $1;
+
+-- name: ListWebhookEndpointsByUserID :many
+SELECT * FROM webhook_endpoints WHERE user_id = $1 ORDER BY created_at;
+
+-- name: GetSubscribedWebhookEndpoints :many
+SELECT * FROM webhook_endpoints WHERE user_id = $1 AND enabled AND sqlc.arg('event')::text = ANY(events);
+
+-- name: DeleteWebhookEndpoint :execrows
+DELETE FROM webhook_endpoints WHERE id = $1 AND user_id = $2;
+
+-- name: EnableWebhookEndpoint :one
+UPDATE webhook_endpoints
+SET enabled = true, failure_count = 0, disabled_at = NULL, updated_at = NOW()
+WHERE id = $1 AND user_id = $2
+RETURNING *;
+
+-- name: RecordWebhookEndpointFailure :one
+UPDATE webhook_endpoints SET failure_count = failure_count + 1 WHERE id = $1
+RETURNING failure_count;
+
+-- name: ResetWebhookEndpointFailures :exec
+UPDATE webhook_endpoints SET failure_count = 0 WHERE id = $1 AND failure_count > 0;
+
+-- name: DisableWebhookEndpoint :exec
+UPDATE webhook_endpoints SET enabled = false, disabled_at = NOW(), updated_at = NOW() WHERE id = $1;
@@ -0,0 +1,28 @@
+-- name: UpsertWebhookEvent :one
+INSERT INTO webhook_events (id, provider, event_id, event_type, payload, occurred_at, received_at, outcome, attempts)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, NOW(), 'pending', 1)
+ON CONFLICT (provider, event_id) DO UPDATE SET attempts = webhook_events.attempts + 1
+RETURNING *;
+
+-- name: MarkWebhookEventProcessed :exec
+UPDATE webhook_events
+SET processed_at = NOW(), outcome = $2, error = NULL
+WHERE id = $1;
+
+-- name: RecordWebhookEventFailure :exec
+INSERT INTO webhook_events (id, provider, event_id, event_type, payload, occurred_at, received_at, outcome, error, attempts)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, NOW(), $6, $7, 1)
+ON CONFLICT (provider, event_id) DO UPDATE SET outcome = EXCLUDED.outcome, error = EXCLUDED.error, attempts = webhook_events.attempts + 1
+WHERE webhook_events.processed_at IS NULL;
+
+-- name: GetWebhookEvent :one
+SELECT * FROM webhook_events WHERE id = $1;
+
+-- name: ListWebhookEvents :many
+SELECT * FROM webhook_events
+WHERE (sqlc.narg('provider')::text IS NULL OR provider = sqlc.narg('provider'))
+  AND (sqlc.narg('event_type')::text IS NULL OR event_type = sqlc.narg('event_type'))
+  AND (sqlc.narg('outcome')::text IS NULL OR outcome = sqlc.narg('outcome'))
+  AND (sqlc.narg('user_id')::text IS NULL OR payload->'data'->>'user_id' = sqlc.narg('user_id'))
+ORDER BY received_at DESC
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
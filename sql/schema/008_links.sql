@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE links (
+    id UUID PRIMARY KEY,
+    chirp_id UUID NOT NULL,
+    code TEXT NOT NULL UNIQUE,
+    url TEXT NOT NULL,
+    start_index INTEGER NOT NULL,
+    end_index INTEGER NOT NULL,
+    clicks BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    CONSTRAINT fk_chirp_id FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE links;
@@ -0,0 +1,18 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN red_expires_at TIMESTAMP;
+
+CREATE TABLE subscription_history (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL,
+    event TEXT NOT NULL,
+    is_chirpy_red BOOLEAN NOT NULL,
+    red_expires_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL,
+    CONSTRAINT fk_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_subscription_history_user_id ON subscription_history (user_id, created_at);
+
+-- +goose Down
+DROP TABLE subscription_history;
+ALTER TABLE users DROP COLUMN red_expires_at;
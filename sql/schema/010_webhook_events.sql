@@ -0,0 +1,21 @@
+-- +goose Up
+CREATE TABLE webhook_events (
+    id UUID PRIMARY KEY,
+    provider TEXT NOT NULL,
+    event_id TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    occurred_at TIMESTAMP,
+    received_at TIMESTAMP NOT NULL,
+    processed_at TIMESTAMP,
+    outcome TEXT NOT NULL,
+    error TEXT,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    CONSTRAINT uq_provider_event_id UNIQUE (provider, event_id)
+);
+
+ALTER TABLE users ADD COLUMN subscription_event_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN subscription_event_at;
+DROP TABLE webhook_events;
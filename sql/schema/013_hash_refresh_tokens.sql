@@ -0,0 +1,13 @@
+-- +goose Up
+-- Tokens are 256-bit random values, so an unsalted SHA-256 is enough to make
+-- a dump of this table useless. Existing rows are rehashed in place and keep
+-- working for clients.
+ALTER TABLE refresh_tokens RENAME COLUMN token TO token_hash;
+UPDATE refresh_tokens SET
+    token_hash = encode(sha256(convert_to(token_hash, 'UTF8')), 'hex'),
+    replaced_by = encode(sha256(convert_to(replaced_by, 'UTF8')), 'hex');
+
+-- +goose Down
+-- Hashes can't be reversed, so every session is logged out.
+DELETE FROM refresh_tokens;
+ALTER TABLE refresh_tokens RENAME COLUMN token_hash TO token;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN sessions_valid_after TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN sessions_valid_after;
@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE login_throttles (
+    kind TEXT NOT NULL CHECK (kind IN ('account', 'ip')),
+    subject TEXT NOT NULL,
+    failure_count INTEGER NOT NULL DEFAULT 0,
+    last_failed_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP,
+    PRIMARY KEY (kind, subject)
+);
+
+CREATE INDEX idx_login_throttles_last_failed_at ON login_throttles (last_failed_at);
+
+-- +goose Down
+DROP TABLE login_throttles;
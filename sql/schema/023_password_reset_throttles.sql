@@ -0,0 +1,10 @@
+-- +goose Up
+ALTER TABLE login_throttles DROP CONSTRAINT login_throttles_kind_check;
+ALTER TABLE login_throttles ADD CONSTRAINT login_throttles_kind_check
+    CHECK (kind IN ('account', 'ip', 'reset_email', 'reset_ip'));
+
+-- +goose Down
+DELETE FROM login_throttles WHERE kind IN ('reset_email', 'reset_ip');
+ALTER TABLE login_throttles DROP CONSTRAINT login_throttles_kind_check;
+ALTER TABLE login_throttles ADD CONSTRAINT login_throttles_kind_check
+    CHECK (kind IN ('account', 'ip'));